@@ -0,0 +1,263 @@
+// Package client is a Go client for the key-value datastore API.
+//
+// A client configured with a KeyProvider encrypts values before they leave
+// the process and decrypts them after they are read, so the server only ever
+// stores ciphertext. See Envelope for the stored format.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	token        string
+	refreshToken string
+	keys         KeyProvider
+
+	// signingKeyID and signingKey sign requests, see WithSigningKey.
+	signingKeyID string
+	signingKey   string
+}
+
+type tokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client requests are sent with.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// WithToken sets the token requests are authorized with, instead of calling
+// Login.
+func WithToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithKeyProvider enables client-side envelope encryption of object values.
+func WithKeyProvider(keys KeyProvider) Option {
+	return func(c *Client) {
+		c.keys = keys
+	}
+}
+
+// New returns a client for the service at baseURL, e.g. "http://localhost:8080".
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{baseURL: strings.TrimSuffix(baseURL, "/"), httpClient: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// Register creates a user on the service's default plan.
+func (c *Client) Register(ctx context.Context, name, password string) error {
+	user := &types.User{Name: name, Password: password}
+	return c.do(ctx, http.MethodPost, "/api/auth/register", user, nil)
+}
+
+// Login authenticates the client; later requests use the issued token.
+func (c *Client) Login(ctx context.Context, name, password string) error {
+	var resp tokenResponse
+	user := &types.User{Name: name, Password: password}
+	if err := c.do(ctx, http.MethodPost, "/api/auth/login", user, &resp); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = resp.Token, resp.RefreshToken
+	return nil
+}
+
+// Refresh replaces the client's access token, which expires after an hour,
+// using the refresh token issued by Login.
+func (c *Client) Refresh(ctx context.Context) error {
+	var resp tokenResponse
+	req := &types.RefreshRequest{RefreshToken: c.refreshToken}
+	if err := c.do(ctx, http.MethodPost, "/api/auth/refresh", req, &resp); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = resp.Token, resp.RefreshToken
+	return nil
+}
+
+// Logout revokes the client's access and refresh tokens.
+func (c *Client) Logout(ctx context.Context) error {
+	if err := c.do(ctx, http.MethodPost, "/api/auth/logout", nil, nil); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = "", ""
+	return nil
+}
+
+// Profile returns the account of the client's user along with its quota.
+func (c *Client) Profile(ctx context.Context) (*types.Profile, error) {
+	profile := &types.Profile{}
+	if err := c.do(ctx, http.MethodGet, "/api/account", nil, profile); err != nil {
+		return nil, err
+	}
+	return profile, nil
+}
+
+// ChangePassword changes the user's password. Every session of the user ends,
+// so the client has to Login again.
+func (c *Client) ChangePassword(ctx context.Context, current, password string) error {
+	req := &types.PasswordChange{CurrentPassword: current, NewPassword: password}
+	if err := c.do(ctx, http.MethodPut, "/api/account/password", req, nil); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = "", ""
+	return nil
+}
+
+// DeleteAccount deletes the user and all of its data.
+func (c *Client) DeleteAccount(ctx context.Context, password string) error {
+	if err := c.do(ctx, http.MethodDelete, "/api/account", &types.AccountDeletion{Password: password}, nil); err != nil {
+		return err
+	}
+	c.token, c.refreshToken = "", ""
+	return nil
+}
+
+// CreateObject stores value under key. With a KeyProvider configured the value
+// is stored as an encrypted Envelope, and the object is tagged with the id of
+// the key encrypting key under KeyIDTag.
+func (c *Client) CreateObject(ctx context.Context, key string, value any, ttl int64) error {
+	obj := &types.Object{Key: key, Value: value, TTL: ttl}
+	if c.keys != nil {
+		env, err := seal(ctx, c.keys, key, value)
+		if err != nil {
+			return err
+		}
+		obj.Value = envelopeValue{Envelope: env}
+		obj.Tags = map[string]string{KeyIDTag: env.KeyID}
+	}
+	return c.do(ctx, http.MethodPost, "/api/object", obj, nil)
+}
+
+// GetObject reads the object stored under key and decodes its value into out,
+// which may be nil. The returned object carries the value as a
+// json.RawMessage. With a KeyProvider configured, values that are not
+// envelopes are rejected with ErrNotEncrypted.
+func (c *Client) GetObject(ctx context.Context, key string, out any) (*types.Object, error) {
+	var resp struct {
+		Key   string          `json:"key"`
+		Value json.RawMessage `json:"value"`
+		TTL   int64           `json:"ttl"`
+	}
+	if err := c.do(ctx, http.MethodGet, "/api/object/"+url.PathEscape(key), nil, &resp); err != nil {
+		return nil, err
+	}
+
+	value := resp.Value
+	if c.keys != nil {
+		var stored envelopeValue
+		if err := json.Unmarshal(resp.Value, &stored); err != nil || stored.Envelope == nil {
+			return nil, ErrNotEncrypted
+		}
+		var err error
+		if value, err = open(ctx, c.keys, key, stored.Envelope); err != nil {
+			return nil, err
+		}
+	}
+	if out != nil {
+		if err := json.Unmarshal(value, out); err != nil {
+			return nil, fmt.Errorf("decoding value: %w", err)
+		}
+	}
+	return &types.Object{Key: resp.Key, Value: value, TTL: resp.TTL}, nil
+}
+
+// KeysEncryptedWith lists the keys under prefix whose values are encrypted
+// with a data key wrapped by the key encrypting key keyID, for example to
+// rewrite them before that key is retired. Only the tags of the objects are
+// matched; their values are not read.
+func (c *Client) KeysEncryptedWith(ctx context.Context, keyID, prefix string) ([]string, error) {
+	req := &types.QueryRequest{
+		Prefix: prefix,
+		Tags:   map[string]string{KeyIDTag: keyID},
+		Fields: []string{"$.kvds_envelope.key_id"},
+	}
+	var keys []string
+	for {
+		var resp types.QueryResponse
+		if err := c.do(ctx, http.MethodPost, "/api/query", req, &resp); err != nil {
+			return nil, err
+		}
+		for _, obj := range resp.Objects {
+			keys = append(keys, obj.Key)
+		}
+		if resp.Cursor == "" {
+			return keys, nil
+		}
+		req.Cursor = resp.Cursor
+	}
+}
+
+func (c *Client) DeleteObject(ctx context.Context, key string) error {
+	return c.do(ctx, http.MethodDelete, "/api/object/"+url.PathEscape(key), nil, nil)
+}
+
+// do sends a JSON request and decodes a successful JSON response into out.
+// Error responses are returned as *utils.Error.
+func (c *Client) do(ctx context.Context, method, path string, body, out any) error {
+	var reqBody io.Reader
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.signingKeyID != "" {
+		if err := c.sign(req, data); err != nil {
+			return err
+		}
+	} else if c.token != "" {
+		req.Header.Set("Authorization", c.token)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErr := &utils.Error{Code: resp.StatusCode}
+		data, _ := io.ReadAll(resp.Body)
+		if json.Unmarshal(data, apiErr) != nil || apiErr.Message == "" {
+			apiErr.Message = strings.TrimSpace(string(data))
+		}
+		apiErr.Code = resp.StatusCode
+		return apiErr
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const (
+	envelopeVersion = 1
+	dataKeySize     = 32 // AES-256
+
+	// KeyIDTag is the object tag holding the id of the key encrypting key of
+	// an encrypted value, so the objects encrypted with a key can be found
+	// without reading them. The envelope holds the same id.
+	KeyIDTag = "kvds-key-id"
+)
+
+var (
+	// ErrNotEncrypted is returned when a client with a KeyProvider reads a
+	// value that is not an envelope. Accepting it would let whoever controls
+	// the server substitute unauthenticated plaintext.
+	ErrNotEncrypted = errors.New("value is not an encrypted envelope")
+
+	ErrUnknownKey = errors.New("unknown key id")
+)
+
+// KeyProvider wraps and unwraps the data keys values are encrypted with. It
+// is typically backed by a KMS or an HSM; StaticKeyProvider keeps the keys in
+// memory.
+type KeyProvider interface {
+	// WrapKey encrypts a data key and returns the id of the key encrypting
+	// key it used, which is stored in the envelope.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrapped []byte, err error)
+	// UnwrapKey decrypts a data key wrapped by the key with the given id.
+	UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error)
+}
+
+// Envelope is what the server stores in place of an encrypted value. Every
+// object gets a fresh data key; the value is sealed with it using AES-GCM,
+// authenticated together with the object key so the server cannot move
+// ciphertext between keys.
+type Envelope struct {
+	Version    int    `json:"version"`
+	KeyID      string `json:"key_id"`
+	WrappedKey []byte `json:"wrapped_key"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// envelopeValue is the JSON value stored for an encrypted object.
+type envelopeValue struct {
+	Envelope *Envelope `json:"kvds_envelope"`
+}
+
+func seal(ctx context.Context, keys KeyProvider, objectKey string, value any) (*Envelope, error) {
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("encoding value: %w", err)
+	}
+
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, err
+	}
+	keyID, wrapped, err := keys.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrapping data key: %w", err)
+	}
+	ciphertext, err := gcmSeal(dataKey, plaintext, []byte(objectKey))
+	if err != nil {
+		return nil, err
+	}
+	return &Envelope{Version: envelopeVersion, KeyID: keyID, WrappedKey: wrapped, Ciphertext: ciphertext}, nil
+}
+
+func open(ctx context.Context, keys KeyProvider, objectKey string, env *Envelope) ([]byte, error) {
+	if env.Version != envelopeVersion {
+		return nil, fmt.Errorf("unsupported envelope version %d", env.Version)
+	}
+	dataKey, err := keys.UnwrapKey(ctx, env.KeyID, env.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrapping data key: %w", err)
+	}
+	plaintext, err := gcmOpen(dataKey, env.Ciphertext, []byte(objectKey))
+	if err != nil {
+		return nil, fmt.Errorf("decrypting value: %w", err)
+	}
+	return plaintext, nil
+}
+
+// StaticKeyProvider wraps data keys with AES-256 key encrypting keys held in
+// memory. New data keys are wrapped with the active key; the others are kept
+// to read values written before a rotation.
+type StaticKeyProvider struct {
+	active string
+	keys   map[string][]byte
+}
+
+func NewStaticKeyProvider(active string, keys map[string][]byte) (*StaticKeyProvider, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, active)
+	}
+	copied := make(map[string][]byte, len(keys))
+	for id, key := range keys {
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes", id, dataKeySize)
+		}
+		copied[id] = append([]byte(nil), key...)
+	}
+	return &StaticKeyProvider{active: active, keys: copied}, nil
+}
+
+func (p *StaticKeyProvider) WrapKey(ctx context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := gcmSeal(p.keys[p.active], dataKey, []byte(p.active))
+	if err != nil {
+		return "", nil, err
+	}
+	return p.active, wrapped, nil
+}
+
+func (p *StaticKeyProvider) UnwrapKey(ctx context.Context, keyID string, wrapped []byte) ([]byte, error) {
+	key, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, keyID)
+	}
+	return gcmOpen(key, wrapped, []byte(keyID))
+}
+
+// gcmSeal encrypts plaintext with AES-GCM and returns the nonce followed by
+// the ciphertext.
+func gcmSeal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+func gcmOpen(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
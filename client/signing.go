@@ -0,0 +1,53 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const signatureAlgorithm = "KVDS-HMAC-SHA256"
+
+// WithSigningKey signs every request with the signing key of an API key
+// instead of sending the API key. Signed requests cannot be modified or
+// replayed, and the key never leaves the process. id and signingKey are
+// returned along with the API key when it is created.
+func WithSigningKey(id, signingKey string) Option {
+	return func(c *Client) {
+		c.signingKeyID, c.signingKey = id, signingKey
+	}
+}
+
+// sign sets the Authorization header of a request to its signature. The
+// server checks the signature against the method, the request URI as sent,
+// the time, a random nonce and the body.
+func (c *Client) sign(req *http.Request, body []byte) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	nonceHex := hex.EncodeToString(nonce)
+	bodyHash := sha256.Sum256(body)
+
+	stringToSign := strings.Join([]string{
+		signatureAlgorithm,
+		req.Method,
+		req.URL.RequestURI(),
+		timestamp,
+		nonceHex,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	mac := hmac.New(sha256.New, []byte(c.signingKey))
+	mac.Write([]byte(stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s, Timestamp=%s, Nonce=%s, Signature=%s",
+		signatureAlgorithm, c.signingKeyID, timestamp, nonceHex, hex.EncodeToString(mac.Sum(nil))))
+	return nil
+}
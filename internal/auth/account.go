@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"log/slog"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// maxPasswordSize is the most bcrypt hashes.
+const maxPasswordSize = 72
+
+// Profile returns the account of the user along with its quota.
+func Profile(db db.Database, userID int) (*types.Profile, error) {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	quota, err := db.GetQuota(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &types.Profile{ID: user.ID, Name: user.Name, Role: user.Role, Quota: quota}, nil
+}
+
+// ChangePassword replaces the user's password and revokes all of its
+// sessions, including the one of the request, and its API keys, so that no
+// credential obtained with the old password outlives it.
+func ChangePassword(db db.Database, userID int, current, password string) error {
+	if password == "" || len(password) > maxPasswordSize {
+		return utils.ErrBadRequest("new password must be between 1 and %d bytes", maxPasswordSize)
+	}
+	if err := checkPassword(db, userID, current); err != nil {
+		return err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		slog.Error("error generating hashed password", "error", err)
+		return utils.ErrInternalServer("")
+	}
+	sessions, err := db.UpdatePassword(userID, string(hashedPassword))
+	if err != nil {
+		return err
+	}
+	for _, id := range sessions {
+		revoke(id)
+	}
+	apiKeys.deleteFunc(func(key *types.APIKey) bool {
+		return key.UserID == int64(userID)
+	})
+	return nil
+}
+
+// DeleteAccount deletes the user and all of its data, once confirmed with the
+// password.
+func DeleteAccount(db db.Database, userID int, password string) error {
+	if err := checkPassword(db, userID, password); err != nil {
+		return err
+	}
+	return deleteUser(db, userID)
+}
+
+// deleteUser deletes the user and drops every credential of it this instance
+// cached.
+func deleteUser(db db.Database, userID int) error {
+	sessions, err := db.DeleteUser(userID)
+	if err != nil {
+		return err
+	}
+	for _, id := range sessions {
+		revoke(id)
+	}
+	apiKeys.deleteFunc(func(key *types.APIKey) bool {
+		return key.UserID == int64(userID)
+	})
+	matchUser := func(id int64) bool {
+		return id == int64(userID)
+	}
+	oidcUsers.deleteFunc(matchUser)
+	certUsers.deleteFunc(matchUser)
+	forgetAccount(userID)
+	return nil
+}
+
+// checkPassword confirms a sensitive change with the user's password. Users
+// provisioned through an identity provider have no password and cannot
+// confirm.
+func checkPassword(db db.Database, userID int, password string) error {
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return err
+	}
+	if password == "" || bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)) != nil {
+		return utils.ErrBadRequest(utils.InvalidCredErr)
+	}
+	return nil
+}
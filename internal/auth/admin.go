@@ -0,0 +1,144 @@
+package auth
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Every user registers with the user role. The first administrators are
+// promoted from the command line with `datastore promote-admin NAME...` once
+// their accounts exist, and administrators promote other users through the
+// API.
+
+// accounts caches the role, suspension and plan of users by id, so that they
+// are not read for every request.
+var accounts = newTTLCache[*types.User]()
+
+// PromoteAdmins gives the named users the administrator role. Users that are
+// already administrators are left as they are, and a name without an account
+// fails the promotion.
+func PromoteAdmins(db db.Database, names []string) error {
+	for _, name := range names {
+		user, err := db.GetUser(name)
+		if err != nil {
+			return fmt.Errorf("user %q: %w", name, err)
+		}
+		if user.Role == types.AdminRole {
+			continue
+		}
+		if err := db.SetRole(int(user.ID), types.AdminRole); err != nil {
+			return fmt.Errorf("user %q: %w", name, err)
+		}
+		forgetAccount(int(user.ID))
+	}
+	return nil
+}
+
+func account(db db.Database, userID int) (*types.User, error) {
+	key := strconv.Itoa(userID)
+	if user, ok := accounts.get(key); ok {
+		return user, nil
+	}
+	user, err := db.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user = &types.User{ID: user.ID, Role: user.Role, Suspended: user.Suspended, Plan: user.Plan}
+	accounts.set(key, user, time.Now().Add(cacheTTL))
+	return user, nil
+}
+
+func forgetAccount(userID int) {
+	accounts.deleteFunc(func(user *types.User) bool {
+		return user.ID == int64(userID)
+	})
+}
+
+// CheckAccount refuses requests of suspended users, and of users deleted
+// since their credentials were issued.
+func CheckAccount(db db.Database, userID int) error {
+	user, err := account(db, userID)
+	if err != nil {
+		return err
+	}
+	if user.Suspended {
+		return utils.ErrForbidden(utils.UserSuspendedErr)
+	}
+	return nil
+}
+
+// AccountPlan returns the plan of a user.
+func AccountPlan(db db.Database, userID int) (*types.Plan, error) {
+	user, err := account(db, userID)
+	if err != nil {
+		return nil, err
+	}
+	return plans.Get(user.Plan), nil
+}
+
+// RequireAdmin refuses users that are not administrators.
+func RequireAdmin(db db.Database, userID int) error {
+	user, err := account(db, userID)
+	if err != nil {
+		return err
+	}
+	if user.Role != types.AdminRole {
+		return utils.ErrForbidden(utils.AdminRequiredErr)
+	}
+	return nil
+}
+
+// SuspendTenant suspends or reinstates a tenant. Requests of a suspended
+// tenant are refused, but its data and credentials are kept.
+func SuspendTenant(db db.Database, adminID, userID int, suspended bool) error {
+	if adminID == userID {
+		return utils.ErrBadRequest("administrators cannot suspend themselves")
+	}
+	if err := db.SetSuspended(userID, suspended); err != nil {
+		return err
+	}
+	forgetAccount(userID)
+	return nil
+}
+
+func SetRole(db db.Database, adminID, userID int, role string) error {
+	if role != types.UserRole && role != types.AdminRole {
+		return utils.ErrBadRequest("role must be %s or %s", types.UserRole, types.AdminRole)
+	}
+	if adminID == userID && role != types.AdminRole {
+		return utils.ErrBadRequest("administrators cannot demote themselves")
+	}
+	if err := db.SetRole(userID, role); err != nil {
+		return err
+	}
+	forgetAccount(userID)
+	return nil
+}
+
+// SetPlan moves a tenant to a plan, replacing its provisioned capacity with
+// the plan's.
+func SetPlan(db db.Database, userID int, name string) error {
+	plan, ok := plans.Lookup(name)
+	if !ok {
+		return utils.ErrBadRequest("unknown plan %q", name)
+	}
+	if err := db.SetPlan(userID, plan); err != nil {
+		return err
+	}
+	forgetAccount(userID)
+	return nil
+}
+
+// DeleteTenant deletes a tenant and all of its data without its password.
+func DeleteTenant(db db.Database, adminID, userID int) error {
+	if adminID == userID {
+		return utils.ErrBadRequest("administrators cannot delete themselves, use the account API")
+	}
+	return deleteUser(db, userID)
+}
@@ -0,0 +1,93 @@
+package auth
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	// APIKeyPrefix starts every API key, which tells them apart from access
+	// tokens in the Authorization header.
+	APIKeyPrefix = "kvds_"
+
+	maxAPIKeys = 100 // per user
+)
+
+// apiKeys caches API keys by hash, and by "id:" followed by their id for
+// signed requests. Expiry is checked on every request, and the last used time
+// recorded at most once per cacheTTL.
+var apiKeys = newTTLCache[*types.APIKey]()
+
+// CreateAPIKey generates an API key for the user. The returned key carries the
+// only copy of the secret, and the signing key for signed requests if they are
+// enabled.
+func CreateAPIKey(db db.Database, userID int, name string, expiresAt int64, scopes []string) (*types.APIKey, error) {
+	id, err := utils.RandomToken(8)
+	if err != nil {
+		slog.Error("error generating api key id", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyCreateErr)
+	}
+	secret, err := utils.RandomToken(32)
+	if err != nil {
+		slog.Error("error generating api key", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyCreateErr)
+	}
+
+	key := &types.APIKey{
+		ID:        id,
+		Name:      name,
+		Key:       APIKeyPrefix + secret,
+		ExpiresAt: expiresAt,
+		CreatedAt: time.Now().Unix(),
+		Scopes:    scopes,
+	}
+	key.KeyHash = hashToken(key.Key)
+	if err := db.CreateAPIKey(userID, key, maxAPIKeys); err != nil {
+		return nil, err
+	}
+	key.SigningKey = SigningKey(key)
+	return key, nil
+}
+
+// RevokeAPIKey deletes an API key of the user.
+func RevokeAPIKey(db db.Database, userID int, id string) error {
+	if err := db.DeleteAPIKey(userID, id); err != nil {
+		return err
+	}
+	apiKeys.deleteFunc(func(key *types.APIKey) bool {
+		return key.ID == id
+	})
+	return nil
+}
+
+func authenticateAPIKey(db db.Database, secret string) (*Claims, error) {
+	hash := hashToken(secret)
+	key, err := useAPIKey(hash, func() (*types.APIKey, error) {
+		return db.UseAPIKey(hash)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Claims{UserID: key.UserID, Scopes: key.Scopes}, nil
+}
+
+// useAPIKey returns the cached key, or loads and caches it, provided it has
+// not expired.
+func useAPIKey(cacheKey string, load func() (*types.APIKey, error)) (*types.APIKey, error) {
+	key, ok := apiKeys.get(cacheKey)
+	if !ok {
+		var err error
+		if key, err = load(); err != nil {
+			return nil, err
+		}
+		apiKeys.set(cacheKey, key, time.Now().Add(cacheTTL))
+	}
+	if key.ExpiresAt != 0 && key.ExpiresAt < time.Now().Unix() {
+		return nil, utils.ErrUnAuthorized(utils.InvalidAPIKeyErr)
+	}
+	return key, nil
+}
@@ -1,11 +1,14 @@
 package auth
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"log/slog"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
 	"github.com/santhoshm25/key-value-ds/types"
 	"github.com/santhoshm25/key-value-ds/utils"
 
@@ -14,25 +17,22 @@ import (
 )
 
 const (
-	DefaultProvisionedCapacity = 1073741824 // 1GB
+	accessTokenTTL  = 1 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
 )
 
-var jwtKey = []byte(os.Getenv("JWT_SECRET_KEY"))
-
 type Claims struct {
-	UserID int64 `json:"user_id"`
+	UserID int64    `json:"user_id"`
+	Scopes []string `json:"scopes,omitempty"`
 	jwt.StandardClaims
 }
 
+// Register creates a user on the default plan.
 func Register(db db.Database, user *types.User) error {
 	if user.Name == "" || user.Password == "" {
 		return utils.ErrBadRequest(utils.InvalidCredErr)
 	}
 
-	if user.ProvisionedCapacity == 0 {
-		user.ProvisionedCapacity = DefaultProvisionedCapacity
-	}
-
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		slog.Error("error generating hashed password", "error", err)
@@ -40,7 +40,8 @@ func Register(db db.Database, user *types.User) error {
 	}
 
 	user.Password = string(hashedPassword)
-	return db.CreateUser(user)
+	user.Role = types.UserRole
+	return db.CreateUser(user, plans.Default())
 }
 
 func Login(db db.Database, user *types.User) (map[string]string, error) {
@@ -58,29 +59,135 @@ func Login(db db.Database, user *types.User) (map[string]string, error) {
 		slog.Error("error comparing hash and password", "error", err)
 		return nil, utils.ErrBadRequest(utils.InvalidCredErr)
 	}
+	if userRec.Suspended {
+		return nil, utils.ErrForbidden(utils.UserSuspendedErr)
+	}
+
+	if err := ValidateScopes(user.Scopes); err != nil {
+		return nil, utils.ErrBadRequest(err.Error())
+	}
+	return newSession(db, userRec.ID, user.Scopes)
+}
 
-	expirationTime := time.Now().Add(1 * time.Hour)
+// Refresh exchanges a refresh token for a new access token and a new refresh
+// token. Each refresh token can be used once.
+func Refresh(db db.Database, refreshToken string) (map[string]string, error) {
+	if refreshToken == "" {
+		return nil, utils.ErrUnAuthorized(utils.InvalidRefreshErr)
+	}
+	newRefreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		slog.Error("error generating refresh token", "error", err)
+		return nil, utils.ErrInternalServer("")
+	}
+	session, err := db.RotateSession(hashToken(refreshToken), hashToken(newRefreshToken))
+	if err != nil {
+		return nil, err
+	}
+	return issueTokens(session, newRefreshToken)
+}
+
+// Logout revokes a session, which invalidates its refresh token and every
+// access token issued for it.
+func Logout(db db.Database, userID int, sessionID string) error {
+	if sessionID == "" {
+		return utils.ErrBadRequest("token does not belong to a session and cannot be revoked")
+	}
+	if err := db.RevokeSession(userID, sessionID); err != nil {
+		return err
+	}
+	revoke(sessionID)
+	return nil
+}
+
+// newSession starts a session for the user and returns its tokens.
+func newSession(db db.Database, userID int64, scopes []string) (map[string]string, error) {
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		slog.Error("error generating session id", "error", err)
+		return nil, utils.ErrInternalServer("")
+	}
+	refreshToken, err := utils.RandomToken(32)
+	if err != nil {
+		slog.Error("error generating refresh token", "error", err)
+		return nil, utils.ErrInternalServer("")
+	}
+
+	session := &types.Session{
+		ID:               id,
+		UserID:           userID,
+		RefreshTokenHash: hashToken(refreshToken),
+		ExpiresAt:        time.Now().Add(refreshTokenTTL).Unix(),
+		Scopes:           scopes,
+	}
+	if err := db.CreateSession(session); err != nil {
+		return nil, err
+	}
+	return issueTokens(session, refreshToken)
+}
+
+// issueTokens signs an access token for the session, which expires after an
+// hour or with the session, whichever comes first.
+func issueTokens(session *types.Session, refreshToken string) (map[string]string, error) {
+	expiresAt := time.Now().Add(accessTokenTTL).Unix()
+	if session.ExpiresAt < expiresAt {
+		expiresAt = session.ExpiresAt
+	}
 	claims := &Claims{
-		UserID: userRec.ID,
+		UserID: session.UserID,
+		Scopes: session.Scopes,
 		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
+			Id:        session.ID,
+			ExpiresAt: expiresAt,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := tokenKeys.sign(claims)
 	if err != nil {
 		slog.Error("error signing token", "error", err)
 		return nil, utils.ErrInternalServer("")
 	}
-	return map[string]string{"token": tokenString}, nil
+	return map[string]string{"token": tokenString, "refresh_token": refreshToken}, nil
+}
+
+// hashToken returns the hex encoded SHA-256 hash refresh tokens are stored as.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Authenticate validates an access token and checks that its session has not
+// been revoked, or validates an API key or a token of the identity provider.
+func Authenticate(db db.Database, tokenString string) (*Claims, error) {
+	if strings.HasPrefix(tokenString, APIKeyPrefix) {
+		return authenticateAPIKey(db, tokenString)
+	}
+	if provider != nil && provider.issuedBy(tokenString) {
+		return provider.authenticate(db, tokenString)
+	}
+
+	claims, err := ValidateToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	// Tokens issued before sessions were introduced carry no session id and
+	// expire within the hour.
+	if claims.Id == "" {
+		return claims, nil
+	}
+	revoked, err := isRevoked(db, claims.Id)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, utils.ErrUnAuthorized(utils.SessionRevokedErr)
+	}
+	return claims, nil
 }
 
 func ValidateToken(tokenString string) (*Claims, error) {
 	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, tokenKeys.verificationKey)
 	if err != nil {
 		slog.Error("error parsing token", "error", err)
 		return nil, utils.ErrInternalServer("")
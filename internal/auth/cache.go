@@ -0,0 +1,77 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// cacheTTL bounds how long credentials seen valid are trusted without asking
+// the database again. Credentials revoked through this instance are rejected
+// at once; other instances notice within this window.
+const cacheTTL = 30 * time.Second
+
+// ttlCache is a map whose entries expire, so that authenticating a request
+// does not hit the database every time.
+type ttlCache[V any] struct {
+	mu        sync.Mutex
+	entries   map[string]ttlEntry[V]
+	lastSweep time.Time
+}
+
+type ttlEntry[V any] struct {
+	value V
+	until time.Time
+}
+
+func newTTLCache[V any]() *ttlCache[V] {
+	return &ttlCache[V]{entries: make(map[string]ttlEntry[V])}
+}
+
+func (c *ttlCache[V]) get(key string) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || time.Now().After(entry.until) {
+		var zero V
+		return zero, false
+	}
+	return entry.value, true
+}
+
+// set caches a value until the given time and, at most once per cacheTTL,
+// drops the entries that expired.
+func (c *ttlCache[V]) set(key string, value V, until time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(c.lastSweep) > cacheTTL {
+		for k, entry := range c.entries {
+			if now.After(entry.until) {
+				delete(c.entries, k)
+			}
+		}
+		c.lastSweep = now
+	}
+	c.entries[key] = ttlEntry[V]{value: value, until: until}
+}
+
+func (c *ttlCache[V]) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.entries, key)
+}
+
+// deleteFunc drops the entries whose value matches.
+func (c *ttlCache[V]) deleteFunc(match func(V) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, entry := range c.entries {
+		if match(entry.value) {
+			delete(c.entries, k)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Client certificates verified by the server authenticate with one of their
+// fields, chosen with TLS_CLIENT_IDENTITY: "cn", the subject common name and
+// the default, or the first "dns", "uri" or "email" subject alternative name.
+// Administrators bind identities to tenants; the identity is not matched
+// against user names, which anyone can register. Certificates have full
+// access to the tenant they are bound to.
+
+const (
+	defaultCertIdentity = "cn"
+	maxCertIdentitySize = 255
+)
+
+var certIdentity = defaultCertIdentity
+
+// certUsers maps certificate identities to user ids.
+var certUsers = newTTLCache[int64]()
+
+func loadCertIdentity() error {
+	field := os.Getenv("TLS_CLIENT_IDENTITY")
+	switch field {
+	case "":
+		certIdentity = defaultCertIdentity
+	case "cn", "dns", "uri", "email":
+		certIdentity = field
+	default:
+		return fmt.Errorf("invalid TLS_CLIENT_IDENTITY %q, must be cn, dns, uri or email", field)
+	}
+	return nil
+}
+
+// AuthenticateCertificate returns the claims of the user a verified client
+// certificate identifies.
+func AuthenticateCertificate(db db.Database, cert *x509.Certificate) (*Claims, error) {
+	identity := certificateIdentity(cert)
+	if identity == "" {
+		return nil, utils.ErrUnAuthorized("client certificate has no %s identity", certIdentity)
+	}
+
+	userID, ok := certUsers.get(identity)
+	if !ok {
+		var err error
+		if userID, err = db.GetCertificateUser(identity); err != nil {
+			if apiErr, ok := err.(*utils.Error); ok && apiErr.Code == http.StatusNotFound {
+				return nil, utils.ErrUnAuthorized("client certificate %q is not bound to a user", identity)
+			}
+			return nil, err
+		}
+		certUsers.set(identity, userID, time.Now().Add(cacheTTL))
+	}
+	return &Claims{UserID: userID}, nil
+}
+
+// BindCertificate lets client certificates with the identity authenticate as
+// the user.
+func BindCertificate(db db.Database, userID int, binding *types.CertificateBinding) error {
+	if binding.Identity == "" || len(binding.Identity) > maxCertIdentitySize {
+		return utils.ErrBadRequest("identity must be between 1 and %d characters", maxCertIdentitySize)
+	}
+	return db.BindCertificate(userID, binding)
+}
+
+// UnbindCertificate stops certificates with the identity from authenticating
+// as the user. Other instances notice within cacheTTL.
+func UnbindCertificate(db db.Database, userID int, identity string) error {
+	if err := db.UnbindCertificate(userID, identity); err != nil {
+		return err
+	}
+	certUsers.delete(identity)
+	return nil
+}
+
+func certificateIdentity(cert *x509.Certificate) string {
+	switch certIdentity {
+	case "dns":
+		if len(cert.DNSNames) > 0 {
+			return cert.DNSNames[0]
+		}
+	case "uri":
+		if len(cert.URIs) > 0 {
+			return cert.URIs[0].String()
+		}
+	case "email":
+		if len(cert.EmailAddresses) > 0 {
+			return cert.EmailAddresses[0]
+		}
+	default:
+		return cert.Subject.CommonName
+	}
+	return ""
+}
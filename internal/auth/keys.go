@@ -0,0 +1,231 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang-jwt/jwt"
+)
+
+// Tokens are signed with RS256 or EdDSA keys read from the PEM files in
+// JWT_KEY_DIR, each named after its key id, e.g. "2026-10.pem". The key named
+// by JWT_ACTIVE_KEY_ID signs new tokens and every key in the directory,
+// including public keys, verifies them. Rotating keys is a matter of adding a
+// key, making it active, and removing the previous key once the tokens it
+// signed expired.
+//
+// Without JWT_KEY_DIR, tokens are signed with the HS256 secret in
+// JWT_SECRET_KEY. When both are set, HS256 tokens are still accepted so that
+// switching to asymmetric keys does not log anyone out.
+
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey // nil for verification only keys
+	public  crypto.PublicKey
+}
+
+type keySet struct {
+	active *signingKey
+	keys   map[string]*signingKey
+	secret []byte
+}
+
+var tokenKeys = &keySet{}
+
+// Init loads the keys tokens are signed and verified with, the identity
+// provider whose tokens are accepted, how client certificates map to users
+// and the secret signed requests are verified with. It must be called once
+// the environment is loaded.
+func Init() {
+	keys, err := loadKeys(os.Getenv("JWT_KEY_DIR"), os.Getenv("JWT_ACTIVE_KEY_ID"), os.Getenv("JWT_SECRET_KEY"))
+	if err != nil {
+		slog.Error("error loading token signing keys", "error", err)
+		os.Exit(1)
+	}
+	tokenKeys = keys
+	if keys.active != nil {
+		slog.Info("signing tokens", "kid", keys.active.id, "alg", keys.active.method.Alg(), "verification_keys", len(keys.keys))
+	}
+
+	provider, err = loadProvider()
+	if err != nil {
+		slog.Error("error configuring identity provider", "error", err)
+		os.Exit(1)
+	}
+	if provider != nil {
+		slog.Info("accepting identity provider tokens", "issuer", provider.issuer, "tenant_claim", provider.tenantClaim)
+	}
+
+	if err := loadCertIdentity(); err != nil {
+		slog.Error("error configuring client certificates", "error", err)
+		os.Exit(1)
+	}
+	if err := loadRequestSigningSecret(); err != nil {
+		slog.Error("error configuring signed requests", "error", err)
+		os.Exit(1)
+	}
+}
+
+func loadKeys(dir, active, secret string) (*keySet, error) {
+	keys := &keySet{keys: make(map[string]*signingKey)}
+	if secret != "" {
+		keys.secret = []byte(secret)
+	}
+	if dir == "" {
+		if keys.secret == nil {
+			return nil, errors.New("JWT_KEY_DIR or JWT_SECRET_KEY is required")
+		}
+		return keys, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		key, err := readKey(file)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+		keys.keys[key.id] = key
+	}
+
+	if active == "" && len(keys.keys) == 1 {
+		for id := range keys.keys {
+			active = id
+		}
+	}
+	key, ok := keys.keys[active]
+	if !ok || key.private == nil {
+		return nil, fmt.Errorf("JWT_ACTIVE_KEY_ID must name a private key in %s", dir)
+	}
+	keys.active = key
+	return keys, nil
+}
+
+func readKey(file string) (*signingKey, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &signingKey{id: strings.TrimSuffix(filepath.Base(file), ".pem")}
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.method, key.public = jwt.SigningMethodRS256, k
+	case ed25519.PrivateKey:
+		key.method, key.private, key.public = jwt.SigningMethodEdDSA, k, k.Public()
+	case ed25519.PublicKey:
+		key.method, key.public = jwt.SigningMethodEdDSA, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, keys must be RSA or Ed25519", parsed)
+	}
+	return key, nil
+}
+
+// sign signs claims with the active key, or with the HS256 secret when no key
+// directory is configured.
+func (k *keySet) sign(claims jwt.Claims) (string, error) {
+	if k.active == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(k.secret)
+	}
+	token := jwt.NewWithClaims(k.active.method, claims)
+	token.Header["kid"] = k.active.id
+	return token.SignedString(k.active.private)
+}
+
+// verificationKey returns the key a token was signed with. The algorithm in
+// the token header has to match the key, so a public key can never be used as
+// an HMAC secret.
+func (k *keySet) verificationKey(token *jwt.Token) (any, error) {
+	if token.Method == jwt.SigningMethodHS256 {
+		if k.secret == nil {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		return k.secret, nil
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("key %q does not sign %s tokens", kid, token.Method.Alg())
+	}
+	return key.public, nil
+}
+
+// JWK is a public verification key in JSON Web Key format.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns the keys tokens are verified with, so that other services
+// can verify tokens without sharing a secret.
+func PublicKeys() *JWKS {
+	jwks := &JWKS{Keys: make([]JWK, 0, len(tokenKeys.keys))}
+	for _, key := range tokenKeys.keys {
+		jwk := JWK{Kid: key.id, Alg: key.method.Alg(), Use: "sig"}
+		switch public := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty, jwk.Crv = "OKP", "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+	return jwks
+}
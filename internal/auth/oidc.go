@@ -0,0 +1,278 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Tokens issued by an external OpenID Connect provider are accepted when
+// OIDC_ISSUER is set. Their signature is checked against the provider's JWKS,
+// found through its discovery document unless OIDC_JWKS_URL is set, and they
+// must name OIDC_AUDIENCE in their audience. The value of OIDC_TENANT_CLAIM,
+// "sub" by default, identifies the tenant; the tenant is created on the
+// default plan the first time it signs in.
+
+const (
+	defaultTenantClaim = "sub"
+
+	// jwksMaxAge is how long the provider's keys are used before they are
+	// fetched again. Tokens signed by an unknown key refetch them sooner, but
+	// at most once per cacheTTL.
+	jwksMaxAge = 1 * time.Hour
+)
+
+type oidcProvider struct {
+	issuer      string
+	audience    string
+	jwksURL     string
+	tenantClaim string
+	client      *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]any
+	fetchedAt time.Time
+}
+
+// provider is nil unless OIDC_ISSUER is set.
+var provider *oidcProvider
+
+// oidcUsers maps the tenant claim to a user id.
+var oidcUsers = newTTLCache[int64]()
+
+func loadProvider() (*oidcProvider, error) {
+	issuer := strings.TrimSuffix(os.Getenv("OIDC_ISSUER"), "/")
+	if issuer == "" {
+		return nil, nil
+	}
+	p := &oidcProvider{
+		issuer:      issuer,
+		audience:    os.Getenv("OIDC_AUDIENCE"),
+		jwksURL:     os.Getenv("OIDC_JWKS_URL"),
+		tenantClaim: os.Getenv("OIDC_TENANT_CLAIM"),
+		client:      &http.Client{Timeout: 10 * time.Second},
+	}
+	if p.audience == "" {
+		return nil, errors.New("OIDC_AUDIENCE is required with OIDC_ISSUER")
+	}
+	if p.tenantClaim == "" {
+		p.tenantClaim = defaultTenantClaim
+	}
+	if os.Getenv("OIDC_PROVISIONED_CAPACITY") != "" {
+		return nil, errors.New("OIDC_PROVISIONED_CAPACITY is no longer supported, provisioned tenants join DEFAULT_PLAN")
+	}
+	return p, nil
+}
+
+// issuedBy reports whether a token claims to come from the provider. The
+// claim is read without verifying the token, which only decides how the token
+// is verified.
+func (p *oidcProvider) issuedBy(tokenString string) bool {
+	claims := jwt.MapClaims{}
+	if _, _, err := new(jwt.Parser).ParseUnverified(tokenString, claims); err != nil {
+		return false
+	}
+	iss, _ := claims["iss"].(string)
+	return strings.TrimSuffix(iss, "/") == p.issuer
+}
+
+// authenticate verifies a token of the provider and returns the claims of the
+// tenant it maps to, provisioning the tenant on first use. Such tokens have
+// full access to the tenant.
+func (p *oidcProvider) authenticate(db db.Database, tokenString string) (*Claims, error) {
+	claims := jwt.MapClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, p.verificationKey)
+	if err != nil || !token.Valid {
+		slog.Error("invalid identity provider token", "error", err)
+		return nil, utils.ErrUnAuthorized(utils.InvalidIdentityTokenErr)
+	}
+	iss, _ := claims["iss"].(string)
+	if strings.TrimSuffix(iss, "/") != p.issuer || !claims.VerifyAudience(p.audience, true) ||
+		!claims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return nil, utils.ErrUnAuthorized(utils.InvalidIdentityTokenErr)
+	}
+	subject, _ := claims[p.tenantClaim].(string)
+	if subject == "" {
+		return nil, utils.ErrUnAuthorized("token has no %q claim", p.tenantClaim)
+	}
+
+	userID, ok := oidcUsers.get(subject)
+	if !ok {
+		if userID, err = db.ProvisionExternalUser(p.issuer, subject, plans.Default()); err != nil {
+			return nil, err
+		}
+		oidcUsers.set(subject, userID, time.Now().Add(cacheTTL))
+	}
+	return &Claims{UserID: userID}, nil
+}
+
+func (p *oidcProvider) verificationKey(token *jwt.Token) (any, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.key(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The key type decides the algorithm, so that a public key can never be
+	// used as an HMAC secret.
+	switch key.(type) {
+	case *rsa.PublicKey:
+		_, ok := token.Method.(*jwt.SigningMethodRSA)
+		if ok {
+			return key, nil
+		}
+	case *ecdsa.PublicKey:
+		_, ok := token.Method.(*jwt.SigningMethodECDSA)
+		if ok {
+			return key, nil
+		}
+	case ed25519.PublicKey:
+		if token.Method == jwt.SigningMethodEdDSA {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("key %q does not sign %s tokens", kid, token.Method.Alg())
+}
+
+// key returns the provider's key with the given id, fetching the provider's
+// keys when they are stale or do not include it.
+func (p *oidcProvider) key(kid string) (any, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	key, ok := p.keys[kid]
+	age := time.Since(p.fetchedAt)
+	if ok && age < jwksMaxAge {
+		return key, nil
+	}
+	if !ok && p.keys != nil && age < cacheTTL {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+
+	keys, err := p.fetchKeys()
+	if err != nil {
+		slog.Error("error fetching identity provider keys", "error", err)
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+	p.keys, p.fetchedAt = keys, time.Now()
+	if key, ok = p.keys[kid]; !ok {
+		return nil, fmt.Errorf("unknown key id %q", kid)
+	}
+	return key, nil
+}
+
+func (p *oidcProvider) fetchKeys() (map[string]any, error) {
+	if p.jwksURL == "" {
+		var discovery struct {
+			Issuer  string `json:"issuer"`
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := p.getJSON(p.issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		if strings.TrimSuffix(discovery.Issuer, "/") != p.issuer || discovery.JWKSURI == "" {
+			return nil, fmt.Errorf("discovery document of %s does not match the issuer", p.issuer)
+		}
+		p.jwksURL = discovery.JWKSURI
+	}
+
+	var jwks struct {
+		Keys []JWK `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURL, &jwks); err != nil {
+		return nil, err
+	}
+	keys := make(map[string]any, len(jwks.Keys))
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			slog.Warn("skipping identity provider key", "kid", jwk.Kid, "error", err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
+
+func (p *oidcProvider) getJSON(url string, v any) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// publicKey decodes an RSA, P-256/P-384/P-521 or Ed25519 key.
+func (jwk *JWK) publicKey() (any, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if jwk.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+}
@@ -0,0 +1,44 @@
+package auth
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// revocations remembers whether sessions are revoked. Live sessions are
+// rechecked after cacheTTL, while revoked sessions are remembered until every
+// access token issued for them expired.
+var revocations = newTTLCache[bool]()
+
+func isRevoked(db db.Database, sessionID string) (bool, error) {
+	if revoked, ok := revocations.get(sessionID); ok {
+		return revoked, nil
+	}
+
+	// Sessions are deleted some time after they expire, so a missing session
+	// is no longer valid.
+	now := time.Now()
+	revoked := true
+	session, err := db.GetSession(sessionID)
+	if err != nil {
+		if apiErr, ok := err.(*utils.Error); !ok || apiErr.Code != http.StatusNotFound {
+			return false, err
+		}
+	} else {
+		revoked = session.Revoked || session.ExpiresAt < now.Unix()
+	}
+
+	if revoked {
+		revocations.set(sessionID, true, now.Add(accessTokenTTL))
+	} else {
+		revocations.set(sessionID, false, now.Add(cacheTTL))
+	}
+	return revoked, nil
+}
+
+func revoke(sessionID string) {
+	revocations.set(sessionID, true, time.Now().Add(accessTokenTTL))
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/santhoshm25/key-value-ds/types"
+)
+
+// Scopes restrict what credentials may do. A scope is a permission, "read",
+// "write" or "delete", optionally followed by ":" and the key prefix it is
+// restricted to, e.g. "read:orders/". Credentials without scopes have full
+// access, including to the routes that do not support scopes.
+
+const maxScopes = 16
+
+// ValidateScopes checks the syntax of scopes.
+func ValidateScopes(scopes []string) error {
+	if len(scopes) > maxScopes {
+		return fmt.Errorf("at most %d scopes are allowed", maxScopes)
+	}
+	for _, scope := range scopes {
+		permission, _, _ := strings.Cut(scope, ":")
+		switch permission {
+		case types.ReadPermission, types.WritePermission, types.DeletePermission:
+		default:
+			return fmt.Errorf("invalid scope %q, the permission must be read, write or delete", scope)
+		}
+	}
+	return nil
+}
+
+// Unrestricted reports whether the claims carry no scopes.
+func (c *Claims) Unrestricted() bool {
+	return len(c.Scopes) == 0
+}
+
+// Allows reports whether the claims grant permission on key.
+func (c *Claims) Allows(permission, key string) bool {
+	if c.Unrestricted() {
+		return true
+	}
+	for _, scope := range c.Scopes {
+		p, prefix, _ := strings.Cut(scope, ":")
+		if p == permission && strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+type claimsKey struct{}
+
+// NewContext returns a context carrying the claims of a request.
+func NewContext(ctx context.Context, claims *Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, claims)
+}
+
+// FromContext returns the claims of a request.
+func FromContext(ctx context.Context) (*Claims, bool) {
+	claims, ok := ctx.Value(claimsKey{}).(*Claims)
+	return claims, ok
+}
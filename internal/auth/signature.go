@@ -0,0 +1,203 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Requests can be signed with an API key instead of carrying it, so that a
+// leaked request can neither be replayed nor modified. The Authorization
+// header of a signed request is
+//
+//	KVDS-HMAC-SHA256 Credential=<key id>, Timestamp=<unix seconds>, Nonce=<nonce>, Signature=<hex>
+//
+// where the signature is the HMAC-SHA256 of StringToSign, keyed with the
+// signing key returned along with the API key when it is created. Signing
+// keys are derived from the API key's id and hash with REQUEST_SIGNING_SECRET,
+// so they are not stored, and whoever can read the database cannot sign
+// without that secret. Signed requests are refused when it is not set. A
+// request is accepted within SignatureMaxSkew of its timestamp, and only
+// once: its nonce is remembered until the timestamp is out of range. Nonces
+// are remembered per instance.
+
+const (
+	SignatureAlgorithm = "KVDS-HMAC-SHA256"
+
+	// SignatureMaxSkew is how far the timestamp of a signed request may be
+	// from the server's clock.
+	SignatureMaxSkew = 5 * time.Minute
+
+	// maxNonces bounds the nonces remembered. Signed requests are refused
+	// while it is full of nonces whose requests are still in range.
+	maxNonces = 100000
+
+	minSigningSecretSize = 32
+)
+
+var requestSigningSecret []byte
+
+var noncePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{16,128}$`)
+
+var nonces = &nonceCache{entries: make(map[string]time.Time)}
+
+func loadRequestSigningSecret() error {
+	secret := os.Getenv("REQUEST_SIGNING_SECRET")
+	if secret != "" && len(secret) < minSigningSecretSize {
+		return fmt.Errorf("REQUEST_SIGNING_SECRET must be at least %d characters", minSigningSecretSize)
+	}
+	requestSigningSecret = nil
+	if secret != "" {
+		requestSigningSecret = []byte(secret)
+	}
+	return nil
+}
+
+// SigningKey returns the key requests are signed with for an API key, or ""
+// when signed requests are disabled.
+func SigningKey(key *types.APIKey) string {
+	if requestSigningSecret == nil {
+		return ""
+	}
+	mac := hmac.New(sha256.New, requestSigningSecret)
+	mac.Write([]byte(key.ID + "\n" + key.KeyHash))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// StringToSign returns what is signed for a request: the method, the request
+// URI with its query exactly as sent, the timestamp, the nonce and the hex
+// encoded SHA-256 hash of the body, separated by newlines.
+func StringToSign(method, requestURI string, timestamp int64, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		SignatureAlgorithm,
+		method,
+		requestURI,
+		strconv.FormatInt(timestamp, 10),
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Sign returns the signature of stringToSign.
+func Sign(signingKey, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(signingKey))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsSigned reports whether an Authorization header carries a signature.
+func IsSigned(authorization string) bool {
+	return strings.HasPrefix(authorization, SignatureAlgorithm+" ")
+}
+
+type signature struct {
+	credential string
+	timestamp  int64
+	nonce      string
+	signature  string
+}
+
+func parseSignature(authorization string) (*signature, error) {
+	sig := &signature{}
+	fields := strings.Split(strings.TrimPrefix(authorization, SignatureAlgorithm+" "), ",")
+	for _, field := range fields {
+		name, value, _ := strings.Cut(strings.TrimSpace(field), "=")
+		switch name {
+		case "Credential":
+			sig.credential = value
+		case "Timestamp":
+			timestamp, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, errors.New("invalid signature timestamp")
+			}
+			sig.timestamp = timestamp
+		case "Nonce":
+			sig.nonce = value
+		case "Signature":
+			sig.signature = value
+		}
+	}
+	if sig.credential == "" || sig.timestamp == 0 || sig.signature == "" {
+		return nil, errors.New("signature requires Credential, Timestamp, Nonce and Signature")
+	}
+	if !noncePattern.MatchString(sig.nonce) {
+		return nil, errors.New("signature nonce must be 16 to 128 letters, digits, '_' or '-'")
+	}
+	return sig, nil
+}
+
+// AuthenticateSignature verifies a signed request and returns the claims of
+// its API key.
+func AuthenticateSignature(db db.Database, authorization, method, requestURI string, body []byte) (*Claims, error) {
+	if requestSigningSecret == nil {
+		return nil, utils.ErrUnAuthorized("signed requests are not enabled")
+	}
+	sig, err := parseSignature(authorization)
+	if err != nil {
+		return nil, utils.ErrUnAuthorized(err.Error())
+	}
+	signedAt := time.Unix(sig.timestamp, 0)
+	if skew := time.Since(signedAt).Abs(); skew > SignatureMaxSkew {
+		return nil, utils.ErrUnAuthorized("request signed at %d is outside the allowed clock skew", sig.timestamp)
+	}
+
+	key, err := useAPIKey("id:"+sig.credential, func() (*types.APIKey, error) {
+		return db.UseAPIKeyByID(sig.credential)
+	})
+	if err != nil {
+		return nil, err
+	}
+	expected := Sign(SigningKey(key), StringToSign(method, requestURI, sig.timestamp, sig.nonce, body))
+	if !hmac.Equal([]byte(expected), []byte(sig.signature)) {
+		return nil, utils.ErrUnAuthorized(utils.InvalidSignatureErr)
+	}
+
+	// Nonces are only remembered for requests with a valid signature, so that
+	// the cache cannot be filled by anyone without the key.
+	if err := nonces.add(key.ID+":"+sig.nonce, signedAt.Add(SignatureMaxSkew)); err != nil {
+		return nil, utils.ErrUnAuthorized(err.Error())
+	}
+	return &Claims{UserID: key.UserID, Scopes: key.Scopes}, nil
+}
+
+// nonceCache remembers the nonces of signed requests until their timestamp is
+// out of range.
+type nonceCache struct {
+	mu      sync.Mutex
+	entries map[string]time.Time
+}
+
+func (c *nonceCache) add(nonce string, until time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if seen, ok := c.entries[nonce]; ok && now.Before(seen) {
+		return errors.New("request was already received")
+	}
+	if len(c.entries) >= maxNonces {
+		for k, seen := range c.entries {
+			if now.After(seen) {
+				delete(c.entries, k)
+			}
+		}
+		if len(c.entries) >= maxNonces {
+			return errors.New("too many signed requests, try again later")
+		}
+	}
+	c.entries[nonce] = until
+	return nil
+}
@@ -1,12 +1,69 @@
 package db
 
-import "github.com/santhoshm25/key-value-ds/types"
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/santhoshm25/key-value-ds/types"
+)
 
 type Database interface {
-	CreateUser(user *types.User) error
+	CreateUser(user *types.User, plan *types.Plan) error
 	GetUser(userName string) (*types.User, error)
+	GetUserByID(userID int) (*types.User, error)
+	UpdatePassword(userID int, password string) ([]string, error)
+	DeleteUser(userID int) ([]string, error)
+	ListTenants(after, limit int) ([]*types.Tenant, error)
+	GetTenant(userID int) (*types.Tenant, error)
+	SetProvisionedCapacity(userID int, provisioned int64) error
+	SetPlan(userID int, plan *types.Plan) error
+	SetQuotaPolicy(userID int, policy string) error
+	SetSuspended(userID int, suspended bool) error
+	SetRole(userID int, role string) error
+	ProvisionExternalUser(issuer, subject string, plan *types.Plan) (int64, error)
+	BindCertificate(userID int, binding *types.CertificateBinding) error
+	ListCertificates(userID int) ([]*types.CertificateBinding, error)
+	UnbindCertificate(userID int, identity string) error
+	GetCertificateUser(identity string) (int64, error)
+	CreateSession(session *types.Session) error
+	RotateSession(refreshTokenHash, newRefreshTokenHash string) (*types.Session, error)
+	RevokeSession(userID int, id string) error
+	GetSession(id string) (*types.Session, error)
+	CreateAPIKey(userID int, key *types.APIKey, limit int) error
+	ListAPIKeys(userID int) ([]*types.APIKey, error)
+	DeleteAPIKey(userID int, id string) error
+	UseAPIKey(keyHash string) (*types.APIKey, error)
+	UseAPIKeyByID(id string) (*types.APIKey, error)
 	CreateObject(userID int, obj *types.Object) error
+	PutBinaryObject(userID int, obj *types.Object) error
 	GetObject(userID int, key string) (*types.Object, error)
+	GetObjectMetadata(userID int, key string) (*types.ObjectMetadata, error)
 	DeleteObject(userID int, key string) error
+	CopyObject(userID int, req *types.MoveRequest) error
+	RenameObject(userID int, req *types.MoveRequest) error
 	BatchCreateObject(userID int, objs []*types.Object) error
+	CompareAndSwapObject(userID int, obj *types.Object, expected json.RawMessage) error
+	AcquireLock(userID int, name, owner string, ttl int64) (*types.Lock, error)
+	RenewLock(userID int, name, owner string, ttl int64) (*types.Lock, error)
+	ReleaseLock(userID int, name, owner string) error
+	GetLock(userID int, name string) (*types.Lock, error)
+	Enqueue(userID int, queue string, msg *types.QueueMessage) error
+	Dequeue(userID int, queue string, visibleAt int64) (*types.QueueMessage, error)
+	AckMessage(userID int, queue string, id int64, receipt string) error
+	ListDeadLetters(userID int, queue string, limit int) ([]*types.QueueMessage, error)
+	DeleteDeadLetter(userID int, queue string, id int64) error
+	CreateIndex(userID int, index *types.Index) error
+	ListIndexes(userID int) ([]*types.Index, error)
+	DeleteIndex(userID int, name string) error
+	QueryIndex(userID int, name string, query *types.IndexQuery) ([]*types.Object, error)
+	ScanObjects(userID int, prefix string, tags map[string]string, after string, limit int) ([]*types.Object, error)
+	PutSchema(userID int, schema *types.Schema) error
+	ListSchemas(userID int) ([]*types.Schema, error)
+	DeleteSchema(userID int, prefix string) error
+	CreateUpload(userID int, upload *types.Upload) error
+	UploadPart(userID int, uploadID string, partNumber int, data []byte) error
+	CompleteUpload(userID int, uploadID string) error
+	AbortUpload(userID int, uploadID string) error
+	StreamObject(userID int, key string, start, end int64, w io.Writer) error
+	GetQuota(userID int) (*types.Quota, error)
 }
@@ -0,0 +1,111 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func (msDB *MysqlDB) GetUserByID(userID int) (*types.User, error) {
+	user := &types.User{ID: int64(userID)}
+	var name sql.NullString
+	err := msDB.Db.QueryRow("SELECT name, password, role, suspended, plan FROM users WHERE id = ?", userID).
+		Scan(&name, &user.Password, &user.Role, &user.Suspended, &user.Plan)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.UserNotFoundErr)
+		}
+		slog.Error("error getting user", "error", err)
+		return nil, utils.ErrInternalServer(utils.UserGetErr)
+	}
+	user.Name = name.String
+	return user, nil
+}
+
+// UpdatePassword replaces the password hash of the user and revokes all of
+// its sessions and API keys. It returns the ids of the sessions that were
+// live.
+func (msDB *MysqlDB) UpdatePassword(userID int, password string) ([]string, error) {
+	var sessions []string
+	err := msDB.withTransaction("password update", utils.UserUpdateErr, nil, func(tx *sql.Tx) error {
+		_, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", password, userID)
+		if err != nil {
+			slog.Error("error updating password", "error", err)
+			return utils.ErrInternalServer(utils.UserUpdateErr)
+		}
+		if sessions, err = selectLiveSessions(tx, userID, utils.UserUpdateErr); err != nil {
+			return err
+		}
+		_, err = tx.Exec("UPDATE sessions SET revoked = TRUE WHERE user_id = ?", userID)
+		if err != nil {
+			slog.Error("error revoking sessions", "error", err)
+			return utils.ErrInternalServer(utils.UserUpdateErr)
+		}
+		_, err = tx.Exec("DELETE FROM api_keys WHERE user_id = ?", userID)
+		if err != nil {
+			slog.Error("error revoking api keys", "error", err)
+			return utils.ErrInternalServer(utils.UserUpdateErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// DeleteUser deletes the user. Its quota, objects, sessions, keys and every
+// other row it owns are deleted through the ON DELETE CASCADE of their
+// foreign keys. It returns the ids of the sessions that were live.
+func (msDB *MysqlDB) DeleteUser(userID int) ([]string, error) {
+	var sessions []string
+	err := msDB.withTransaction("user deletion", utils.UserDeleteErr, nil, func(tx *sql.Tx) error {
+		var err error
+		if sessions, err = selectLiveSessions(tx, userID, utils.UserDeleteErr); err != nil {
+			return err
+		}
+		res, err := tx.Exec("DELETE FROM users WHERE id = ?", userID)
+		if err != nil {
+			slog.Error("error deleting user", "error", err)
+			return utils.ErrInternalServer(utils.UserDeleteErr)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return utils.ErrNotFound(utils.UserNotFoundErr)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	msDB.dataKeys.Delete(userID)
+	slog.Info("user deleted", "id", userID)
+	return sessions, nil
+}
+
+func selectLiveSessions(tx *sql.Tx, userID int, errorMsg string) ([]string, error) {
+	rows, err := tx.Query("SELECT id FROM sessions WHERE user_id = ? AND revoked = FALSE AND expires_at > ? FOR UPDATE", userID, time.Now().Unix())
+	if err != nil {
+		slog.Error("error getting sessions", "error", err)
+		return nil, utils.ErrInternalServer(errorMsg)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			slog.Error("error scanning session", "error", err)
+			return nil, utils.ErrInternalServer(errorMsg)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error getting sessions", "error", err)
+		return nil, utils.ErrInternalServer(errorMsg)
+	}
+	return ids, nil
+}
@@ -0,0 +1,136 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const selectTenants = "SELECT u.id, u.name, u.role, u.suspended, q.provisioned, q.utilised, q.policy, u.plan FROM users u JOIN quotas q ON q.user_id = u.id "
+
+// ListTenants returns up to limit tenants with an id greater than after, in
+// id order.
+func (msDB *MysqlDB) ListTenants(after, limit int) ([]*types.Tenant, error) {
+	rows, err := msDB.Db.Query(selectTenants+"WHERE u.id > ? ORDER BY u.id LIMIT ?", after, limit)
+	if err != nil {
+		slog.Error("error getting tenants", "error", err)
+		return nil, utils.ErrInternalServer(utils.TenantGetErr)
+	}
+	defer rows.Close()
+
+	tenants := []*types.Tenant{}
+	for rows.Next() {
+		tenant, err := scanTenant(rows)
+		if err != nil {
+			slog.Error("error scanning tenant", "error", err)
+			return nil, utils.ErrInternalServer(utils.TenantGetErr)
+		}
+		tenants = append(tenants, tenant)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error getting tenants", "error", err)
+		return nil, utils.ErrInternalServer(utils.TenantGetErr)
+	}
+	return tenants, nil
+}
+
+func (msDB *MysqlDB) GetTenant(userID int) (*types.Tenant, error) {
+	tenant, err := scanTenant(msDB.Db.QueryRow(selectTenants+"WHERE u.id = ?", userID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.UserNotFoundErr)
+		}
+		slog.Error("error getting tenant", "error", err)
+		return nil, utils.ErrInternalServer(utils.TenantGetErr)
+	}
+	return tenant, nil
+}
+
+func scanTenant(row interface{ Scan(...any) error }) (*types.Tenant, error) {
+	tenant := &types.Tenant{Quota: &types.Quota{}}
+	var name sql.NullString
+	err := row.Scan(&tenant.ID, &name, &tenant.Role, &tenant.Suspended,
+		&tenant.Quota.Provisioned, &tenant.Quota.Utilised, &tenant.Quota.Policy, &tenant.Quota.Plan)
+	tenant.Name = name.String
+	return tenant, err
+}
+
+// SetProvisionedCapacity changes the capacity of a tenant. A capacity below
+// the utilised one only refuses further writes.
+func (msDB *MysqlDB) SetProvisionedCapacity(userID int, provisioned int64) error {
+	return msDB.updateUser(userID, "UPDATE quotas SET provisioned = ? WHERE user_id = ?", provisioned, userID)
+}
+
+// SetQuotaPolicy changes how future writes of a tenant are charged. Stored
+// objects keep the size they were charged at until they are rewritten or
+// deleted.
+func (msDB *MysqlDB) SetQuotaPolicy(userID int, policy string) error {
+	return msDB.updateUser(userID, "UPDATE quotas SET policy = ? WHERE user_id = ?", policy, userID)
+}
+
+// SetPlan moves a tenant to a plan and provisions it the plan's capacity.
+func (msDB *MysqlDB) SetPlan(userID int, plan *types.Plan) error {
+	return msDB.withTransaction("plan update", utils.UserUpdateErr, nil, func(tx *sql.Tx) error {
+		{
+			var id int64
+			err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&id)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return utils.ErrNotFound(utils.UserNotFoundErr)
+				}
+				slog.Error("error getting user", "error", err)
+				return utils.ErrInternalServer(utils.UserUpdateErr)
+			}
+		}
+		{
+			_, err := tx.Exec("UPDATE users SET plan = ? WHERE id = ?", plan.Name, userID)
+			if err != nil {
+				slog.Error("error updating plan", "error", err)
+				return utils.ErrInternalServer(utils.UserUpdateErr)
+			}
+		}
+		{
+			_, err := tx.Exec("UPDATE quotas SET provisioned = ? WHERE user_id = ?", plan.Capacity, userID)
+			if err != nil {
+				slog.Error("error updating quota", "error", err)
+				return utils.ErrInternalServer(utils.UserUpdateErr)
+			}
+		}
+		return nil
+	})
+}
+
+func (msDB *MysqlDB) SetSuspended(userID int, suspended bool) error {
+	return msDB.updateUser(userID, "UPDATE users SET suspended = ? WHERE id = ?", suspended, userID)
+}
+
+func (msDB *MysqlDB) SetRole(userID int, role string) error {
+	return msDB.updateUser(userID, "UPDATE users SET role = ? WHERE id = ?", role, userID)
+}
+
+// updateUser runs an update of a single user's row. MySQL reports rows that
+// already held the values as unaffected, so the user's existence is checked
+// separately when nothing changed.
+func (msDB *MysqlDB) updateUser(userID int, query string, args ...any) error {
+	res, err := msDB.Db.Exec(query, args...)
+	if err != nil {
+		slog.Error("error updating user", "error", err)
+		return utils.ErrInternalServer(utils.UserUpdateErr)
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	var exists bool
+	err = msDB.Db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)", userID).Scan(&exists)
+	if err != nil {
+		slog.Error("error getting user", "error", err)
+		return utils.ErrInternalServer(utils.UserUpdateErr)
+	}
+	if !exists {
+		return utils.ErrNotFound(utils.UserNotFoundErr)
+	}
+	return nil
+}
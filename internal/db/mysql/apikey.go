@@ -0,0 +1,128 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// CreateAPIKey stores a new API key unless the user already has limit keys.
+func (msDB *MysqlDB) CreateAPIKey(userID int, key *types.APIKey, limit int) error {
+	return msDB.withTransaction("api key creation", utils.APIKeyCreateErr, nil, func(tx *sql.Tx) error {
+		{
+			// Lock the user so that concurrent creations cannot exceed the limit.
+			var id int
+			if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&id); err != nil {
+				slog.Error("error locking user", "error", err)
+				return utils.ErrInternalServer(utils.APIKeyCreateErr)
+			}
+		}
+		{
+			var count int
+			if err := tx.QueryRow("SELECT COUNT(*) FROM api_keys WHERE user_id = ?", userID).Scan(&count); err != nil {
+				slog.Error("error counting api keys", "error", err)
+				return utils.ErrInternalServer(utils.APIKeyCreateErr)
+			}
+			if count >= limit {
+				return utils.ErrForbidden(utils.APIKeyLimitErr)
+			}
+		}
+		{
+			scopes, err := encodeScopes(key.Scopes)
+			if err != nil {
+				slog.Error("error marshalling scopes", "error", err)
+				return utils.ErrInternalServer(utils.APIKeyCreateErr)
+			}
+			_, err = tx.Exec("INSERT INTO api_keys (id, user_id, name, key_hash, created_at, expires_at, scopes) VALUES (?, ?, ?, ?, ?, ?, ?)",
+				key.ID, userID, key.Name, key.KeyHash, key.CreatedAt, key.ExpiresAt, scopes)
+			if err != nil {
+				slog.Error("error creating api key", "error", err)
+				return utils.ErrInternalServer(utils.APIKeyCreateErr)
+			}
+		}
+		return nil
+	})
+}
+
+func (msDB *MysqlDB) ListAPIKeys(userID int) ([]*types.APIKey, error) {
+	rows, err := msDB.Db.Query("SELECT id, name, created_at, expires_at, last_used_at, scopes FROM api_keys WHERE user_id = ? ORDER BY created_at, id", userID)
+	if err != nil {
+		slog.Error("error listing api keys", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+	}
+	defer rows.Close()
+
+	keys := make([]*types.APIKey, 0)
+	for rows.Next() {
+		key := &types.APIKey{}
+		var scopes []byte
+		if err := rows.Scan(&key.ID, &key.Name, &key.CreatedAt, &key.ExpiresAt, &key.LastUsedAt, &scopes); err != nil {
+			slog.Error("error scanning api key", "error", err)
+			return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+		}
+		if key.Scopes, err = decodeScopes(scopes); err != nil {
+			slog.Error("error unmarshalling scopes", "error", err)
+			return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error listing api keys", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+	}
+	return keys, nil
+}
+
+func (msDB *MysqlDB) DeleteAPIKey(userID int, id string) error {
+	res, err := msDB.Db.Exec("DELETE FROM api_keys WHERE user_id = ? AND id = ?", userID, id)
+	if err != nil {
+		slog.Error("error deleting api key", "error", err)
+		return utils.ErrInternalServer(utils.APIKeyDeleteErr)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return utils.ErrNotFound(utils.APIKeyNotFoundErr)
+	}
+	return nil
+}
+
+// UseAPIKey returns the API key with the given hash and records that it was
+// used.
+func (msDB *MysqlDB) UseAPIKey(keyHash string) (*types.APIKey, error) {
+	return msDB.useAPIKey("key_hash", keyHash)
+}
+
+// UseAPIKeyByID returns the API key with the given id, including its hash,
+// and records that it was used.
+func (msDB *MysqlDB) UseAPIKeyByID(id string) (*types.APIKey, error) {
+	return msDB.useAPIKey("id", id)
+}
+
+func (msDB *MysqlDB) useAPIKey(column, value string) (*types.APIKey, error) {
+	key := &types.APIKey{}
+	var scopes []byte
+	err := msDB.Db.QueryRow("SELECT id, user_id, name, key_hash, created_at, expires_at, scopes FROM api_keys WHERE "+column+" = ?", value).
+		Scan(&key.ID, &key.UserID, &key.Name, &key.KeyHash, &key.CreatedAt, &key.ExpiresAt, &scopes)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrUnAuthorized(utils.InvalidAPIKeyErr)
+		}
+		slog.Error("error getting api key", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+	}
+	if key.Scopes, err = decodeScopes(scopes); err != nil {
+		slog.Error("error unmarshalling scopes", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+	}
+
+	key.LastUsedAt = time.Now().Unix()
+	_, err = msDB.Db.Exec("UPDATE api_keys SET last_used_at = ? WHERE id = ?", key.LastUsedAt, key.ID)
+	if err != nil {
+		slog.Error("error updating api key", "error", err)
+		return nil, utils.ErrInternalServer(utils.APIKeyGetErr)
+	}
+	return key, nil
+}
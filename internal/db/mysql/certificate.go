@@ -0,0 +1,84 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// BindCertificate lets client certificates with the identity authenticate as
+// the user. An identity is bound to at most one user.
+func (msDB *MysqlDB) BindCertificate(userID int, binding *types.CertificateBinding) error {
+	binding.CreatedAt = time.Now().Unix()
+	_, err := msDB.Db.Exec("INSERT INTO certificate_identities (identity, user_id, created_at) VALUES (?, ?, ?)",
+		binding.Identity, userID, binding.CreatedAt)
+	if err != nil {
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok {
+			switch mysqlErr.Number {
+			case 1062:
+				return utils.ErrConflict(utils.CertificateBoundErr)
+			case 1452:
+				return utils.ErrNotFound(utils.UserNotFoundErr)
+			}
+		}
+		slog.Error("error binding certificate", "error", err)
+		return utils.ErrInternalServer(utils.CertificateBindErr)
+	}
+	return nil
+}
+
+func (msDB *MysqlDB) ListCertificates(userID int) ([]*types.CertificateBinding, error) {
+	rows, err := msDB.Db.Query("SELECT identity, created_at FROM certificate_identities WHERE user_id = ? ORDER BY identity", userID)
+	if err != nil {
+		slog.Error("error listing certificates", "error", err)
+		return nil, utils.ErrInternalServer(utils.CertificateGetErr)
+	}
+	defer rows.Close()
+
+	bindings := make([]*types.CertificateBinding, 0)
+	for rows.Next() {
+		binding := &types.CertificateBinding{}
+		if err := rows.Scan(&binding.Identity, &binding.CreatedAt); err != nil {
+			slog.Error("error scanning certificate", "error", err)
+			return nil, utils.ErrInternalServer(utils.CertificateGetErr)
+		}
+		bindings = append(bindings, binding)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error listing certificates", "error", err)
+		return nil, utils.ErrInternalServer(utils.CertificateGetErr)
+	}
+	return bindings, nil
+}
+
+func (msDB *MysqlDB) UnbindCertificate(userID int, identity string) error {
+	res, err := msDB.Db.Exec("DELETE FROM certificate_identities WHERE user_id = ? AND identity = ?", userID, identity)
+	if err != nil {
+		slog.Error("error unbinding certificate", "error", err)
+		return utils.ErrInternalServer(utils.CertificateUnbindErr)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return utils.ErrNotFound(utils.CertificateNotFoundErr)
+	}
+	return nil
+}
+
+// GetCertificateUser returns the user a certificate identity is bound to.
+func (msDB *MysqlDB) GetCertificateUser(identity string) (int64, error) {
+	var id int64
+	err := msDB.Db.QueryRow("SELECT user_id FROM certificate_identities WHERE identity = ?", identity).Scan(&id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, utils.ErrNotFound(utils.CertificateNotFoundErr)
+		}
+		slog.Error("error getting certificate", "error", err)
+		return 0, utils.ErrInternalServer(utils.CertificateGetErr)
+	}
+	return id, nil
+}
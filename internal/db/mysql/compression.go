@@ -0,0 +1,113 @@
+package mysql
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+
+	"github.com/santhoshm25/key-value-ds/types"
+)
+
+const (
+	identityEncoding = "identity"
+	gzipEncoding     = "gzip"
+
+	defaultCompressionThreshold = 1024 //1KB
+)
+
+// storedValue is a value on its way to data_store. Plain JSON values live in
+// the data_value column and raw bytes in data_blob; compressed or encrypted
+// values of either kind live in data_blob.
+type storedValue struct {
+	data        []byte // the value as the client sent it
+	isJSON      bool
+	contentType string
+	tags        map[string]string
+
+	encoding  string
+	encrypted bool
+	stored    []byte // data after encoding and encryption
+}
+
+func jsonValue(data []byte) *storedValue {
+	return &storedValue{data: data, isJSON: true, contentType: jsonContentType}
+}
+
+func binaryValue(data []byte, contentType string) *storedValue {
+	return &storedValue{data: data, contentType: contentType}
+}
+
+// size is the logical size of the value, which the value size limit applies to.
+func (val *storedValue) size() int64 {
+	return int64(len(val.data))
+}
+
+// chargedSize is the size counted against the quota under the given policy.
+func (val *storedValue) chargedSize(policy string) int64 {
+	if policy == types.PhysicalQuotaPolicy {
+		return int64(len(val.stored))
+	}
+	return val.size()
+}
+
+// columns returns the data_value and data_blob columns of the value.
+func (val *storedValue) columns() ([]byte, []byte) {
+	if val.isJSON && val.encoding == identityEncoding && !val.encrypted {
+		return val.stored, nil
+	}
+	return nil, val.stored
+}
+
+// compress gzips values of at least the configured threshold and keeps the
+// result only when it is smaller than the original. A non-positive threshold
+// disables compression.
+func (msDB *MysqlDB) compress(val *storedValue) error {
+	val.stored, val.encoding = val.data, identityEncoding
+	if msDB.compressionThreshold <= 0 || len(val.data) < msDB.compressionThreshold {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(val.data); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if buf.Len() < len(val.data) {
+		val.stored, val.encoding = buf.Bytes(), gzipEncoding
+	}
+	return nil
+}
+
+// storedRow holds the data_store columns a value is read back from.
+type storedRow struct {
+	json      []byte
+	blob      []byte
+	encoding  string
+	encrypted bool
+}
+
+// loadValue returns the bytes of the value of a key as the client sent them.
+func (msDB *MysqlDB) loadValue(userID int, key string, row *storedRow) ([]byte, error) {
+	data := row.blob
+	if row.json != nil {
+		data = row.json
+	}
+	if row.encrypted {
+		var err error
+		if data, err = msDB.open(userID, key, data); err != nil {
+			return nil, err
+		}
+	}
+	if row.encoding == gzipEncoding {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	}
+	return data, nil
+}
@@ -0,0 +1,195 @@
+package mysql
+
+import (
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// CopyObject writes a copy of an object under another key. The stored bytes,
+// chunks and index entries are copied as they are, so the value is not
+// re-encoded; only encrypted bytes are sealed again for the destination. The
+// copy is charged to the quota like any other write.
+func (msDB *MysqlDB) CopyObject(userID int, req *types.MoveRequest) error {
+	return msDB.withTransaction("object copy", utils.ObjectCopyErr, utils.ErrStatusCreated(utils.ObjectCopied), func(tx *sql.Tx) error {
+		source, destination, err := selectMove(tx, userID, req, utils.ObjectCopyErr)
+		if err != nil {
+			return err
+		}
+		if err := msDB.validateMoveSchema(tx, userID, req, utils.ObjectCopyErr); err != nil {
+			return err
+		}
+		{
+			quota, err := selectQuota(tx, userID)
+			if err != nil {
+				return utils.ErrInternalServer(utils.ObjectCopyErr)
+			}
+			if quota.Utilised-destination.chargedSize+source.chargedSize > quota.Provisioned {
+				return utils.ErrForbidden(utils.QuotaExceededErr)
+			}
+		}
+		if err := deleteDestination(tx, userID, req.Destination, destination, utils.ObjectCopyErr); err != nil {
+			return err
+		}
+		{
+			now := time.Now().Unix()
+			createdAt, version := destination.next(now)
+			_, err := tx.Exec("INSERT INTO data_store (user_id, data_key, data_value, data_blob, is_json, encoding, encrypted, content_type, data_size, charged_size, chunked, tags, version, created_at, updated_at, ttl) "+
+				"SELECT user_id, ?, data_value, data_blob, is_json, encoding, encrypted, content_type, data_size, charged_size, chunked, tags, ?, ?, ?, ttl FROM data_store WHERE user_id = ? AND data_key = ?",
+				req.Destination, version, createdAt, now, userID, req.Source)
+			if err != nil {
+				slog.Error("error copying object", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCopyErr)
+			}
+		}
+		{
+			_, err := tx.Exec("INSERT INTO object_chunks (user_id, data_key, chunk_offset, data, encrypted, size) SELECT user_id, ?, chunk_offset, data, encrypted, size FROM object_chunks WHERE user_id = ? AND data_key = ?",
+				req.Destination, userID, req.Source)
+			if err != nil {
+				slog.Error("error copying chunks", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCopyErr)
+			}
+		}
+		if err := msDB.rebind(tx, userID, req.Source, req.Destination); err != nil {
+			slog.Error("error re-encrypting object", "error", err)
+			return utils.ErrInternalServer(utils.ObjectCopyErr)
+		}
+		{
+			_, err := tx.Exec("INSERT INTO index_entries (user_id, index_name, data_key, value_string, value_number) SELECT user_id, index_name, ?, value_string, value_number FROM index_entries WHERE user_id = ? AND data_key = ?",
+				req.Destination, userID, req.Source)
+			if err != nil {
+				slog.Error("error copying index entries", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCopyErr)
+			}
+		}
+		if err := updateUtilised(tx, userID, source.chargedSize-destination.chargedSize); err != nil {
+			return utils.ErrInternalServer(utils.ObjectCopyErr)
+		}
+		return nil
+	})
+}
+
+// RenameObject moves an object to another key in place. Its chunks and index
+// entries follow through the ON UPDATE CASCADE of their foreign keys, and
+// encrypted bytes are sealed again for the new key. The
+// object keeps its creation time and tags, and its version continues from the
+// object it replaces so that the destination's ETag never repeats.
+func (msDB *MysqlDB) RenameObject(userID int, req *types.MoveRequest) error {
+	return msDB.withTransaction("object rename", utils.ObjectRenameErr, utils.ErrStatusOK(utils.ObjectRenamed), func(tx *sql.Tx) error {
+		_, destination, err := selectMove(tx, userID, req, utils.ObjectRenameErr)
+		if err != nil {
+			return err
+		}
+		if err := msDB.validateMoveSchema(tx, userID, req, utils.ObjectRenameErr); err != nil {
+			return err
+		}
+		if err := deleteDestination(tx, userID, req.Destination, destination, utils.ObjectRenameErr); err != nil {
+			return err
+		}
+		{
+			now := time.Now().Unix()
+			_, version := destination.next(now)
+			_, err := tx.Exec("UPDATE data_store SET data_key = ?, version = ?, updated_at = ? WHERE user_id = ? AND data_key = ?",
+				req.Destination, version, now, userID, req.Source)
+			if err != nil {
+				slog.Error("error renaming object", "error", err)
+				return utils.ErrInternalServer(utils.ObjectRenameErr)
+			}
+		}
+		if err := msDB.rebind(tx, userID, req.Source, req.Destination); err != nil {
+			slog.Error("error re-encrypting object", "error", err)
+			return utils.ErrInternalServer(utils.ObjectRenameErr)
+		}
+		if err := updateUtilised(tx, userID, -destination.chargedSize); err != nil {
+			return utils.ErrInternalServer(utils.ObjectRenameErr)
+		}
+		return nil
+	})
+}
+
+// selectMove locks the source and destination rows of a copy or rename. Both
+// are locked by a single statement so that moves in opposite directions lock
+// them in the same order. An expired source is missing and an expired
+// destination may always be replaced.
+func selectMove(tx *sql.Tx, userID int, req *types.MoveRequest, errorMsg string) (source, destination existingObject, err error) {
+	rows, err := tx.Query("SELECT data_key, charged_size, created_at, version, ttl FROM data_store WHERE user_id = ? AND data_key IN (?, ?) FOR UPDATE",
+		userID, req.Source, req.Destination)
+	if err != nil {
+		slog.Error("error getting objects", "error", err)
+		return source, destination, utils.ErrInternalServer(errorMsg)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var key string
+		var obj existingObject
+		if err := rows.Scan(&key, &obj.chargedSize, &obj.createdAt, &obj.version, &obj.ttl); err != nil {
+			slog.Error("error scanning object", "error", err)
+			return source, destination, utils.ErrInternalServer(errorMsg)
+		}
+		if key == req.Source {
+			source = obj
+		} else {
+			destination = obj
+		}
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error getting objects", "error", err)
+		return source, destination, utils.ErrInternalServer(errorMsg)
+	}
+
+	if !source.exists() || isExpired(source.ttl) {
+		return source, destination, utils.ErrNotFound(utils.ObjectNotFoundErr)
+	}
+	if destination.exists() && !isExpired(destination.ttl) && !req.Overwrite {
+		return source, destination, utils.ErrConflict(utils.ObjectExistsErr)
+	}
+	return source, destination, nil
+}
+
+// validateMoveSchema checks the value moved to the destination against the
+// schema of the destination. Binary and chunked values are not checked.
+func (msDB *MysqlDB) validateMoveSchema(tx *sql.Tx, userID int, req *types.MoveRequest, errorMsg string) error {
+	schemas, err := newSchemaValidator(tx, userID)
+	if err != nil {
+		return err
+	}
+	if schemas.match(req.Destination) == nil {
+		return nil
+	}
+
+	row := &storedRow{}
+	var isJSON, chunked bool
+	err = tx.QueryRow("SELECT data_value, data_blob, encoding, encrypted, is_json, chunked FROM data_store WHERE user_id = ? AND data_key = ?", userID, req.Source).
+		Scan(&row.json, &row.blob, &row.encoding, &row.encrypted, &isJSON, &chunked)
+	if err != nil {
+		slog.Error("error getting object", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+	if !isJSON || chunked {
+		return nil
+	}
+	data, err := msDB.loadValue(userID, req.Source, row)
+	if err != nil {
+		slog.Error("error decoding value", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+	return schemas.validateJSON(req.Destination, data)
+}
+
+// deleteDestination removes the object a move replaces, along with its chunks
+// and index entries. The caller refunds its charged size.
+func deleteDestination(tx *sql.Tx, userID int, key string, destination existingObject, errorMsg string) error {
+	if !destination.exists() {
+		return nil
+	}
+	_, err := tx.Exec("DELETE FROM data_store WHERE user_id = ? AND data_key = ?", userID, key)
+	if err != nil {
+		slog.Error("error deleting destination object", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+
+	"github.com/santhoshm25/key-value-ds/internal/keyring"
+)
+
+// dataKey returns the tenant's data key, creating it on first use. Keys are
+// created outside of the caller's transaction so a rolled back write can never
+// leave a cached key that was not stored.
+func (msDB *MysqlDB) dataKey(userID int) ([]byte, error) {
+	if key, ok := msDB.dataKeys.Load(userID); ok {
+		return key.([]byte), nil
+	}
+
+	var masterKeyID string
+	var wrapped []byte
+	err := msDB.Db.QueryRow("SELECT master_key_id, wrapped_key FROM tenant_keys WHERE user_id = ?", userID).Scan(&masterKeyID, &wrapped)
+	if errors.Is(err, sql.ErrNoRows) {
+		_, newWrapped, err := msDB.keyring.NewDataKey()
+		if err != nil {
+			return nil, err
+		}
+		// A concurrent request may have created the key first, in which case
+		// its key wins and is read back below.
+		_, err = msDB.Db.Exec("INSERT IGNORE INTO tenant_keys (user_id, master_key_id, wrapped_key) VALUES (?, ?, ?)",
+			userID, msDB.keyring.ActiveID(), newWrapped)
+		if err != nil {
+			return nil, err
+		}
+		err = msDB.Db.QueryRow("SELECT master_key_id, wrapped_key FROM tenant_keys WHERE user_id = ?", userID).Scan(&masterKeyID, &wrapped)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := msDB.keyring.Unwrap(masterKeyID, wrapped)
+	if err != nil {
+		return nil, err
+	}
+	msDB.dataKeys.Store(userID, key)
+	return key, nil
+}
+
+// encrypt seals the stored bytes of the value of a key with the tenant's data
+// key. Values are stored in plaintext when no master key is configured.
+func (msDB *MysqlDB) encrypt(userID int, key string, val *storedValue) error {
+	if msDB.keyring == nil {
+		return nil
+	}
+	sealed, err := msDB.seal(userID, key, val.stored)
+	if err != nil {
+		return err
+	}
+	val.stored, val.encrypted = sealed, true
+	return nil
+}
+
+// Encrypted values, chunks and parts are bound to the tenant and the key they
+// are stored under, so that the ciphertext of one row cannot be swapped into
+// another by anyone with write access to the database.
+func boundTo(userID int, key string) []byte {
+	return []byte(strconv.Itoa(userID) + ":" + key)
+}
+
+func (msDB *MysqlDB) seal(userID int, key string, data []byte) ([]byte, error) {
+	dataKey, err := msDB.dataKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	return keyring.Seal(dataKey, data, boundTo(userID, key))
+}
+
+// open decrypts data sealed for the key. Data sealed before values were bound
+// to their key is still opened, and is bound when it is next written.
+func (msDB *MysqlDB) open(userID int, key string, sealed []byte) ([]byte, error) {
+	if msDB.keyring == nil {
+		return nil, errors.New("encrypted value found but no master key is configured")
+	}
+	dataKey, err := msDB.dataKey(userID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := keyring.Open(dataKey, sealed, boundTo(userID, key))
+	if err != nil {
+		if legacy, legacyErr := keyring.Open(dataKey, sealed, nil); legacyErr == nil {
+			return legacy, nil
+		}
+	}
+	return data, err
+}
+
+// rebind seals the encrypted value and chunks of a key again for the key,
+// after they were copied or renamed from another key.
+func (msDB *MysqlDB) rebind(tx *sql.Tx, userID int, from, to string) error {
+	var sealed []byte
+	err := tx.QueryRow("SELECT data_blob FROM data_store WHERE user_id = ? AND data_key = ? AND encrypted", userID, to).Scan(&sealed)
+	switch {
+	case err == nil:
+		resealed, err := msDB.reseal(userID, from, to, sealed)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE data_store SET data_blob = ? WHERE user_id = ? AND data_key = ?", resealed, userID, to); err != nil {
+			return err
+		}
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	var offsets []int64
+	{
+		rows, err := tx.Query("SELECT chunk_offset FROM object_chunks WHERE user_id = ? AND data_key = ? AND encrypted", userID, to)
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			var offset int64
+			if err := rows.Scan(&offset); err != nil {
+				rows.Close()
+				return err
+			}
+			offsets = append(offsets, offset)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	// Chunks are read one at a time, so large objects are never held whole.
+	for _, offset := range offsets {
+		if err := tx.QueryRow("SELECT data FROM object_chunks WHERE user_id = ? AND data_key = ? AND chunk_offset = ?", userID, to, offset).Scan(&sealed); err != nil {
+			return err
+		}
+		resealed, err := msDB.reseal(userID, from, to, sealed)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE object_chunks SET data = ? WHERE user_id = ? AND data_key = ? AND chunk_offset = ?", resealed, userID, to, offset); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (msDB *MysqlDB) reseal(userID int, from, to string, sealed []byte) ([]byte, error) {
+	data, err := msDB.open(userID, from, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return msDB.seal(userID, to, data)
+}
+
+// rewrapDataKeys wraps every data key that is not wrapped with the active
+// master key again with it. Only the small tenant_keys rows are rewritten;
+// values stay encrypted with the same data keys.
+func (msDB *MysqlDB) rewrapDataKeys() error {
+	rows, err := msDB.Db.Query("SELECT user_id, master_key_id, wrapped_key FROM tenant_keys WHERE master_key_id != ?", msDB.keyring.ActiveID())
+	if err != nil {
+		return err
+	}
+	type tenantKey struct {
+		userID      int
+		masterKeyID string
+		wrapped     []byte
+	}
+	var stale []tenantKey
+	for rows.Next() {
+		var tk tenantKey
+		if err := rows.Scan(&tk.userID, &tk.masterKeyID, &tk.wrapped); err != nil {
+			rows.Close()
+			return err
+		}
+		stale = append(stale, tk)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, tk := range stale {
+		key, err := msDB.keyring.Unwrap(tk.masterKeyID, tk.wrapped)
+		if err != nil {
+			return err
+		}
+		wrapped, err := msDB.keyring.Wrap(key)
+		if err != nil {
+			return err
+		}
+		_, err = msDB.Db.Exec("UPDATE tenant_keys SET master_key_id = ?, wrapped_key = ? WHERE user_id = ? AND master_key_id = ?",
+			msDB.keyring.ActiveID(), wrapped, tk.userID, tk.masterKeyID)
+		if err != nil {
+			return err
+		}
+	}
+	if len(stale) > 0 {
+		slog.Info("re-wrapped data keys", "count", len(stale), "master_key_id", msDB.keyring.ActiveID())
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// errIdentityExists reports that another request provisioned the identity
+// first.
+var errIdentityExists = errors.New("identity already provisioned")
+
+// ProvisionExternalUser returns the user an identity of an external identity
+// provider maps to, creating the user and its quota the first time the
+// identity is seen on the given plan. Provisioned users have no name or
+// password, so they can only sign in through the provider.
+func (msDB *MysqlDB) ProvisionExternalUser(issuer, subject string, plan *types.Plan) (int64, error) {
+	id, err := msDB.getExternalUser(issuer, subject)
+	if err == nil || !errors.Is(err, sql.ErrNoRows) {
+		return id, err
+	}
+
+	err = msDB.withTransaction("user provisioning", utils.UserProvisionErr, nil, func(tx *sql.Tx) error {
+		{
+			res, err := tx.Exec("INSERT INTO users (name, password, plan) VALUES (NULL, '', ?)", plan.Name)
+			if err != nil {
+				slog.Error("error creating user", "error", err)
+				return utils.ErrInternalServer(utils.UserProvisionErr)
+			}
+			id, _ = res.LastInsertId()
+		}
+		{
+			_, err := tx.Exec("INSERT INTO quotas (user_id, provisioned, utilised) VALUES (?, ?, ?)", id, plan.Capacity, 0)
+			if err != nil {
+				slog.Error("error creating quota", "error", err)
+				return utils.ErrInternalServer(utils.UserProvisionErr)
+			}
+		}
+		{
+			_, err := tx.Exec("INSERT INTO external_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)",
+				issuer, subject, id, time.Now().Unix())
+			if err != nil {
+				if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+					return errIdentityExists
+				}
+				slog.Error("error creating external identity", "error", err)
+				return utils.ErrInternalServer(utils.UserProvisionErr)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errIdentityExists) {
+		return msDB.getExternalUser(issuer, subject)
+	}
+	if err != nil {
+		return 0, err
+	}
+	slog.Info("user provisioned", "id", id, "issuer", issuer, "subject", subject)
+	return id, nil
+}
+
+// getExternalUser returns sql.ErrNoRows for identities that were never seen.
+func (msDB *MysqlDB) getExternalUser(issuer, subject string) (int64, error) {
+	var id int64
+	err := msDB.Db.QueryRow("SELECT user_id FROM external_identities WHERE issuer = ? AND subject = ?", issuer, subject).Scan(&id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("error getting external identity", "error", err)
+		return 0, utils.ErrInternalServer(utils.UserGetErr)
+	}
+	return id, err
+}
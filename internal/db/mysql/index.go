@@ -0,0 +1,331 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/santhoshm25/key-value-ds/internal/jsonpath"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	maxIndexesPerUser    = 16
+	maxIndexedStringSize = 255
+
+	// indexPageSize is how many objects are indexed per transaction when an
+	// index is created.
+	indexPageSize = 500
+)
+
+// valueIndex is an index definition with its path already parsed.
+type valueIndex struct {
+	name string
+	path jsonpath.Path
+}
+
+func (msDB *MysqlDB) CreateIndex(userID int, index *types.Index) error {
+	path, err := jsonpath.Parse(index.Path)
+	if err != nil {
+		return utils.ErrBadRequest(err.Error())
+	}
+
+	err = msDB.withTransaction("index creation", utils.IndexCreateErr, nil, func(tx *sql.Tx) error {
+		{
+			var count int
+			err := tx.QueryRow("SELECT COUNT(*) FROM value_indexes WHERE user_id = ?", userID).Scan(&count)
+			if err != nil {
+				slog.Error("error counting indexes", "error", err)
+				return utils.ErrInternalServer(utils.IndexCreateErr)
+			}
+			if count >= maxIndexesPerUser {
+				return utils.ErrBadRequest("index limit reached, at most %d indexes are allowed", maxIndexesPerUser)
+			}
+		}
+		{
+			_, err := tx.Exec("INSERT INTO value_indexes (user_id, index_name, json_path) VALUES (?, ?, ?)", userID, index.Name, path.String())
+			if err != nil {
+				if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
+					return utils.ErrBadRequest(utils.IndexExistsErr)
+				}
+				slog.Error("error creating index", "error", err)
+				return utils.ErrInternalServer(utils.IndexCreateErr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := msDB.fillIndex(userID); err != nil {
+		_, err := msDB.Db.Exec("DELETE FROM value_indexes WHERE user_id = ? AND index_name = ?", userID, index.Name)
+		if err != nil {
+			slog.Error("error deleting unfilled index", "error", err)
+		}
+		return utils.ErrInternalServer(utils.IndexCreateErr)
+	}
+	return utils.ErrStatusCreated(utils.IndexCreated)
+}
+
+// fillIndex indexes the existing objects of a user after an index is created.
+// The objects are read in pages by key, each in its own transaction, so that
+// neither the values nor the locks of a whole tenant are held at once. Writes
+// committed after the index definition index their objects themselves, and
+// the pages lock the objects they read, so no object is left indexed with an
+// older value.
+func (msDB *MysqlDB) fillIndex(userID int) error {
+	after := ""
+	for {
+		var page []objectValue
+		err := msDB.withTransaction("index filling", utils.IndexCreateErr, nil, func(tx *sql.Tx) error {
+			indexes, err := selectIndexes(tx, userID)
+			if err != nil {
+				return err
+			}
+			if page, err = msDB.selectObjectValues(tx, userID, after); err != nil {
+				return err
+			}
+			for _, obj := range page {
+				if err := reindexObject(tx, userID, obj.key, obj.value, indexes); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		if len(page) < indexPageSize {
+			return nil
+		}
+		after = page[len(page)-1].key
+	}
+}
+
+func (msDB *MysqlDB) ListIndexes(userID int) ([]*types.Index, error) {
+	rows, err := msDB.Db.Query("SELECT index_name, json_path FROM value_indexes WHERE user_id = ? ORDER BY index_name", userID)
+	if err != nil {
+		slog.Error("error listing indexes", "error", err)
+		return nil, utils.ErrInternalServer(utils.IndexGetErr)
+	}
+	defer rows.Close()
+
+	indexes := make([]*types.Index, 0)
+	for rows.Next() {
+		index := &types.Index{}
+		if err := rows.Scan(&index.Name, &index.Path); err != nil {
+			slog.Error("error scanning index", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexGetErr)
+		}
+		indexes = append(indexes, index)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error listing indexes", "error", err)
+		return nil, utils.ErrInternalServer(utils.IndexGetErr)
+	}
+	return indexes, nil
+}
+
+func (msDB *MysqlDB) DeleteIndex(userID int, name string) error {
+	res, err := msDB.Db.Exec("DELETE FROM value_indexes WHERE user_id = ? AND index_name = ?", userID, name)
+	if err != nil {
+		slog.Error("error deleting index", "error", err)
+		return utils.ErrInternalServer(utils.IndexDeleteErr)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return utils.ErrNotFound(utils.IndexNotFoundErr)
+	}
+	return nil
+}
+
+// QueryIndex returns the live objects whose indexed field matches the query.
+// Numeric bounds are compared against numeric fields and string bounds against
+// string fields; the handler guarantees that a query does not mix the two.
+func (msDB *MysqlDB) QueryIndex(userID int, name string, query *types.IndexQuery) ([]*types.Object, error) {
+	{
+		var exists int
+		err := msDB.Db.QueryRow("SELECT 1 FROM value_indexes WHERE user_id = ? AND index_name = ?", userID, name).Scan(&exists)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil, utils.ErrNotFound(utils.IndexNotFoundErr)
+			}
+			slog.Error("error getting index", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+		}
+	}
+
+	bounds := []struct {
+		op    string
+		value any
+	}{{"=", query.Eq}, {">", query.Gt}, {">=", query.Gte}, {"<", query.Lt}, {"<=", query.Lte}}
+
+	column := "e.value_string"
+	for _, bound := range bounds {
+		if _, ok := bound.value.(float64); ok {
+			column = "e.value_number"
+		}
+	}
+
+	where := "e.user_id = ? AND e.index_name = ? AND (d.ttl = 0 OR d.ttl >= ?)"
+	args := []any{userID, name, time.Now().Unix()}
+	for _, bound := range bounds {
+		if bound.value != nil {
+			where += " AND " + column + " " + bound.op + " ?"
+			args = append(args, bound.value)
+		}
+	}
+	args = append(args, query.Limit)
+
+	rows, err := msDB.Db.Query("SELECT d.data_key, d.data_value, d.data_blob, d.encoding, d.encrypted, d.tags, d.created_at, d.updated_at, d.ttl FROM index_entries e JOIN data_store d ON d.user_id = e.user_id AND d.data_key = e.data_key WHERE "+
+		where+" ORDER BY "+column+", e.data_key LIMIT ?", args...)
+	if err != nil {
+		slog.Error("error querying index", "error", err)
+		return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+	}
+	defer rows.Close()
+
+	objs := make([]*types.Object, 0)
+	for rows.Next() {
+		row := &storedRow{}
+		var tags []byte
+		obj := &types.Object{}
+		if err := rows.Scan(&obj.Key, &row.json, &row.blob, &row.encoding, &row.encrypted, &tags, &obj.CreatedAt, &obj.UpdatedAt, &obj.TTL); err != nil {
+			slog.Error("error scanning object", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+		}
+		if obj.Tags, err = decodeTags(tags); err != nil {
+			slog.Error("error unmarshalling tags", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+		}
+		valBytes, err := msDB.loadValue(userID, obj.Key, row)
+		if err != nil {
+			slog.Error("error decoding value", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+		}
+		if err := json.Unmarshal(valBytes, &obj.Value); err != nil {
+			slog.Error("error unmarshalling value", "error", err)
+			return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+		}
+		objs = append(objs, obj)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error querying index", "error", err)
+		return nil, utils.ErrInternalServer(utils.IndexQueryErr)
+	}
+	return objs, nil
+}
+
+func selectIndexes(tx *sql.Tx, userID int) ([]valueIndex, error) {
+	rows, err := tx.Query("SELECT index_name, json_path FROM value_indexes WHERE user_id = ?", userID)
+	if err != nil {
+		slog.Error("error getting indexes", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var indexes []valueIndex
+	for rows.Next() {
+		var name, rawPath string
+		if err := rows.Scan(&name, &rawPath); err != nil {
+			slog.Error("error scanning index", "error", err)
+			return nil, err
+		}
+		path, err := jsonpath.Parse(rawPath)
+		if err != nil {
+			slog.Error("error parsing index path", "index", name, "error", err)
+			return nil, err
+		}
+		indexes = append(indexes, valueIndex{name: name, path: path})
+	}
+	return indexes, rows.Err()
+}
+
+// objectValue is the JSON value of an object as the client sent it.
+type objectValue struct {
+	key   string
+	value []byte
+}
+
+// selectObjectValues locks and returns the JSON values of the next page of
+// live objects of a user, in key order after the given key.
+func (msDB *MysqlDB) selectObjectValues(tx *sql.Tx, userID int, after string) ([]objectValue, error) {
+	rows, err := tx.Query("SELECT data_key, data_value, data_blob, encoding, encrypted FROM data_store WHERE user_id = ? AND data_key > ? AND (ttl = 0 OR ttl >= ?) AND is_json = TRUE ORDER BY data_key LIMIT ? FOR UPDATE",
+		userID, after, time.Now().Unix(), indexPageSize)
+	if err != nil {
+		slog.Error("error getting objects", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	values := make([]objectValue, 0, indexPageSize)
+	for rows.Next() {
+		var key string
+		row := &storedRow{}
+		if err := rows.Scan(&key, &row.json, &row.blob, &row.encoding, &row.encrypted); err != nil {
+			slog.Error("error scanning object", "error", err)
+			return nil, err
+		}
+		valBytes, err := msDB.loadValue(userID, key, row)
+		if err != nil {
+			slog.Error("error decoding value", "error", err)
+			return nil, err
+		}
+		values = append(values, objectValue{key: key, value: valBytes})
+	}
+	return values, rows.Err()
+}
+
+// reindexObject replaces the index entries of a single object. It has to be
+// called in the same transaction as every write to data_store; deletions are
+// handled by the foreign key cascade on index_entries.
+func reindexObject(tx *sql.Tx, userID int, key string, valBytes []byte, indexes []valueIndex) error {
+	if len(indexes) == 0 {
+		return nil
+	}
+
+	_, err := tx.Exec("DELETE FROM index_entries WHERE user_id = ? AND data_key = ?", userID, key)
+	if err != nil {
+		slog.Error("error deleting index entries", "error", err)
+		return err
+	}
+
+	var doc any
+	if err := json.Unmarshal(valBytes, &doc); err != nil {
+		slog.Error("error unmarshalling value", "error", err)
+		return err
+	}
+
+	for _, index := range indexes {
+		field, ok := index.path.Lookup(doc)
+		if !ok {
+			continue
+		}
+
+		var valueString, valueNumber any
+		switch field := field.(type) {
+		case string:
+			if len(field) > maxIndexedStringSize {
+				continue
+			}
+			valueString = field
+		case float64:
+			valueNumber = field
+		default:
+			continue
+		}
+
+		_, err := tx.Exec("INSERT INTO index_entries (user_id, index_name, data_key, value_string, value_number) VALUES (?, ?, ?, ?, ?)",
+			userID, index.name, key, valueString, valueNumber)
+		if err != nil {
+			slog.Error("error inserting index entry", "error", err)
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Locks expire like objects, with a unix ttl checked by isExpired, but live in
+// their own table: expired objects are deleted by the clean_expired_data event,
+// which would reset the fencing token of a lock stored as an object.
+
+// AcquireLock takes the named lock for owner until ttl. The fencing token is
+// incremented on every successful acquisition and never reset, so holders can
+// reject writes carrying a stale token.
+func (msDB *MysqlDB) AcquireLock(userID int, name, owner string, ttl int64) (*types.Lock, error) {
+	lock := &types.Lock{Name: name}
+	err := msDB.withTransaction("lock acquisition", utils.LockAcquireErr, nil, func(tx *sql.Tx) error {
+		{
+			// Make sure the row exists so that the SELECT ... FOR UPDATE below
+			// serialises concurrent acquirers of a brand new lock.
+			_, err := tx.Exec("INSERT IGNORE INTO locks (user_id, lock_name) VALUES (?, ?)", userID, name)
+			if err != nil {
+				slog.Error("error creating lock", "error", err)
+				return utils.ErrInternalServer(utils.LockAcquireErr)
+			}
+		}
+		{
+			current, err := selectLockForUpdate(tx, userID, name)
+			if err != nil {
+				return utils.ErrInternalServer(utils.LockAcquireErr)
+			}
+			if current.Owner != "" && !isExpired(current.TTL) {
+				return utils.ErrConflict(utils.LockHeldErr)
+			}
+			lock.FencingToken = current.FencingToken + 1
+			lock.Owner = owner
+			lock.TTL = ttl
+		}
+		{
+			_, err := tx.Exec("UPDATE locks SET owner = ?, fencing_token = ?, ttl = ? WHERE user_id = ? AND lock_name = ?",
+				lock.Owner, lock.FencingToken, lock.TTL, userID, name)
+			if err != nil {
+				slog.Error("error acquiring lock", "error", err)
+				return utils.ErrInternalServer(utils.LockAcquireErr)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (msDB *MysqlDB) RenewLock(userID int, name, owner string, ttl int64) (*types.Lock, error) {
+	var lock *types.Lock
+	err := msDB.withTransaction("lock renewal", utils.LockRenewErr, nil, func(tx *sql.Tx) error {
+		current, err := selectLockForUpdate(tx, userID, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrNotFound(utils.LockNotFoundErr)
+			}
+			return utils.ErrInternalServer(utils.LockRenewErr)
+		}
+		if current.Owner != owner || isExpired(current.TTL) {
+			return utils.ErrConflict(utils.LockNotHeldErr)
+		}
+
+		_, err = tx.Exec("UPDATE locks SET ttl = ? WHERE user_id = ? AND lock_name = ?", ttl, userID, name)
+		if err != nil {
+			slog.Error("error renewing lock", "error", err)
+			return utils.ErrInternalServer(utils.LockRenewErr)
+		}
+		current.TTL = ttl
+		lock = current
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
+
+func (msDB *MysqlDB) ReleaseLock(userID int, name, owner string) error {
+	return msDB.withTransaction("lock release", utils.LockReleaseErr, nil, func(tx *sql.Tx) error {
+		current, err := selectLockForUpdate(tx, userID, name)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrNotFound(utils.LockNotFoundErr)
+			}
+			return utils.ErrInternalServer(utils.LockReleaseErr)
+		}
+		if current.Owner != owner || isExpired(current.TTL) {
+			return utils.ErrConflict(utils.LockNotHeldErr)
+		}
+
+		// The row is kept so the fencing token keeps increasing across holders.
+		_, err = tx.Exec("UPDATE locks SET owner = NULL, ttl = 0 WHERE user_id = ? AND lock_name = ?", userID, name)
+		if err != nil {
+			slog.Error("error releasing lock", "error", err)
+			return utils.ErrInternalServer(utils.LockReleaseErr)
+		}
+		return nil
+	})
+}
+
+func (msDB *MysqlDB) GetLock(userID int, name string) (*types.Lock, error) {
+	var owner sql.NullString
+	lock := &types.Lock{Name: name}
+
+	err := msDB.Db.QueryRow("SELECT owner, fencing_token, ttl FROM locks WHERE user_id = ? AND lock_name = ?", userID, name).
+		Scan(&owner, &lock.FencingToken, &lock.TTL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.LockNotFoundErr)
+		}
+		slog.Error("error getting lock", "error", err)
+		return nil, utils.ErrInternalServer(utils.LockGetErr)
+	}
+	if isExpired(lock.TTL) {
+		return &types.Lock{Name: name, FencingToken: lock.FencingToken}, nil
+	}
+	lock.Owner = owner.String
+	return lock, nil
+}
+
+func selectLockForUpdate(tx *sql.Tx, userID int, name string) (*types.Lock, error) {
+	var owner sql.NullString
+	lock := &types.Lock{Name: name}
+
+	err := tx.QueryRow("SELECT owner, fencing_token, ttl FROM locks WHERE user_id = ? AND lock_name = ? FOR UPDATE", userID, name).
+		Scan(&owner, &lock.FencingToken, &lock.TTL)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("error getting lock", "error", err)
+		}
+		return nil, err
+	}
+	lock.Owner = owner.String
+	return lock, nil
+}
@@ -1,27 +1,42 @@
 package mysql
 
 import (
+	"bytes"
 	"database/sql"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
 	"os"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-sql-driver/mysql"
 
+	"github.com/santhoshm25/key-value-ds/internal/keyring"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
 	"github.com/santhoshm25/key-value-ds/internal/server"
 	"github.com/santhoshm25/key-value-ds/types"
 	"github.com/santhoshm25/key-value-ds/utils"
 )
 
 const (
-	maxValueSize = 16384 //16KB
+	jsonContentType = "application/json"
 )
 
 type MysqlDB struct {
 	Db *sql.DB
+
+	// Values of at least this many bytes are stored gzip compressed.
+	compressionThreshold int
+
+	// keyring wraps the per-tenant data keys that values are encrypted with.
+	// Encryption is disabled when it is nil.
+	keyring  *keyring.Keyring
+	dataKeys sync.Map // user id -> unwrapped data key
 }
 
 func NewDB() *MysqlDB {
@@ -45,13 +60,43 @@ func (msDB *MysqlDB) Init() {
 
 	msDB.Db = db
 	slog.Info("Successfully connected to the database!")
+
+	msDB.compressionThreshold = defaultCompressionThreshold
+	if threshold := os.Getenv("VALUE_COMPRESSION_THRESHOLD"); threshold != "" {
+		msDB.compressionThreshold, err = strconv.Atoi(threshold)
+		if err != nil {
+			slog.Error("invalid value compression threshold", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	go msDB.sweepUploads()
+
+	msDB.keyring, err = keyring.Load()
+	if err != nil {
+		slog.Error("error loading master keys", "error", err)
+		os.Exit(1)
+	}
+	if msDB.keyring == nil {
+		slog.Warn("no master key configured, values are stored unencrypted")
+		return
+	}
+	if err = msDB.rewrapDataKeys(); err != nil {
+		slog.Error("error re-wrapping data keys", "error", err)
+		os.Exit(1)
+	}
 }
 
-func (msDB *MysqlDB) CreateUser(user *types.User) (err error) {
+// CreateUser creates the user on a plan, with the plan's capacity.
+func (msDB *MysqlDB) CreateUser(user *types.User, plan *types.Plan) (err error) {
 	return msDB.withTransaction("user creation", utils.UserCreateErr, utils.ErrStatusCreated(utils.UserCreated), func(tx *sql.Tx) error {
 		var id int64
 		{
-			res, err := tx.Exec("INSERT INTO users (name, password) VALUES (?, ?)", user.Name, user.Password)
+			role := user.Role
+			if role == "" {
+				role = types.UserRole
+			}
+			res, err := tx.Exec("INSERT INTO users (name, password, role, plan) VALUES (?, ?, ?, ?)", user.Name, user.Password, role, plan.Name)
 			if err != nil {
 				if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == 1062 {
 					return utils.ErrBadRequest(utils.UserExistsErr)
@@ -63,7 +108,7 @@ func (msDB *MysqlDB) CreateUser(user *types.User) (err error) {
 			slog.Info("user created", "id", id)
 		}
 		{
-			_, err = tx.Exec("INSERT INTO quotas (user_id, provisioned, utilised) VALUES (?, ?, ?)", id, user.ProvisionedCapacity, 0)
+			_, err = tx.Exec("INSERT INTO quotas (user_id, provisioned, utilised) VALUES (?, ?, ?)", id, plan.Capacity, 0)
 			if err != nil {
 				slog.Error("error creating user", "error", err)
 				return utils.ErrInternalServer(utils.UserCreateErr)
@@ -76,7 +121,8 @@ func (msDB *MysqlDB) CreateUser(user *types.User) (err error) {
 func (msDB *MysqlDB) GetUser(userName string) (*types.User, error) {
 	user := &types.User{}
 
-	err := msDB.Db.QueryRow("SELECT id, password FROM users WHERE name = ?", userName).Scan(&user.ID, &user.Password)
+	err := msDB.Db.QueryRow("SELECT id, password, role, suspended, plan FROM users WHERE name = ?", userName).
+		Scan(&user.ID, &user.Password, &user.Role, &user.Suspended, &user.Plan)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, utils.ErrNotFound(utils.UserNotFoundErr)
@@ -89,57 +135,179 @@ func (msDB *MysqlDB) GetUser(userName string) (*types.User, error) {
 
 func (msDB *MysqlDB) CreateObject(userID int, obj *types.Object) error {
 	return msDB.withTransaction("object creation", utils.ObjectCreateErr, utils.ErrStatusCreated(utils.ObjectCreated), func(tx *sql.Tx) error {
-		quota := &types.Quota{}
-		var valBytes []byte
-		{
-			err := tx.QueryRow("SELECT provisioned, utilised FROM quotas WHERE user_id = ?", userID).Scan(&quota.Provisioned, &quota.Utilised)
-			if err != nil {
-				slog.Error("error getting quota", "error", err)
-				return utils.ErrInternalServer(utils.ObjectCreateErr)
-			}
-			valBytes, err = json.Marshal(obj.Value)
-			if err != nil {
-				slog.Error("error marshalling value", "error", err)
-				return utils.ErrInternalServer(utils.ObjectCreateErr)
-			}
-			if err = validateQuota(quota, valBytes); err != nil {
-				slog.Error("error validating object", "error", err.Error())
-				return err
-			}
+		valBytes, err := json.Marshal(obj.Value)
+		if err != nil {
+			slog.Error("error marshalling value", "error", err)
+			return utils.ErrInternalServer(utils.ObjectCreateErr)
 		}
-		{
-			_, err := tx.Exec("REPLACE INTO data_store (user_id, data_key, data_value, ttl) VALUES (?, ?, ?, ?)", userID, obj.Key, valBytes, obj.TTL)
-			if err != nil {
-				slog.Error("error creating object", "error", err)
-				return utils.ErrInternalServer(utils.ObjectCreateErr)
-			}
+		val := jsonValue(valBytes)
+		val.tags = obj.Tags
+		return msDB.putObject(tx, userID, obj.Key, val, obj.TTL, utils.ObjectCreateErr)
+	})
+}
+
+// PutBinaryObject stores obj.Data verbatim along with its content type.
+func (msDB *MysqlDB) PutBinaryObject(userID int, obj *types.Object) error {
+	return msDB.withTransaction("binary object creation", utils.ObjectCreateErr, utils.ErrStatusCreated(utils.ObjectCreated), func(tx *sql.Tx) error {
+		return msDB.putObject(tx, userID, obj.Key, binaryValue(obj.Data, obj.ContentType), obj.TTL, utils.ObjectCreateErr)
+	})
+}
+
+// putObject writes a single value, charging the quota only for the difference
+// with the value it replaces, and refreshes the object's index entries. The
+// creation time of a replaced object is kept. JSON values are checked against
+// the schema of their key.
+func (msDB *MysqlDB) putObject(tx *sql.Tx, userID int, key string, val *storedValue, ttl int64, errorMsg string) error {
+	quota, err := selectQuota(tx, userID)
+	if err != nil {
+		return utils.ErrInternalServer(errorMsg)
+	}
+	if err := validateValueSize(quota, val.size()); err != nil {
+		return err
+	}
+	if val.isJSON {
+		schemas, err := newSchemaValidator(tx, userID)
+		if err != nil {
+			return err
 		}
-		{
-			_, err := tx.Exec("UPDATE quotas SET utilised = utilised + ? WHERE user_id = ?", len(valBytes), userID)
-			if err != nil {
-				slog.Error("error updating quota", "error", err)
-				return utils.ErrInternalServer(utils.ObjectCreateErr)
-			}
+		if err := schemas.validateJSON(key, val.data); err != nil {
+			return err
 		}
-		return nil
-	})
+	}
+	if err := msDB.compress(val); err != nil {
+		slog.Error("error compressing value", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+	if err := msDB.encrypt(userID, key, val); err != nil {
+		slog.Error("error encrypting value", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+
+	var existing existingObject
+	var chargedSize int64
+	{
+		existing, err = selectExistingObject(tx, userID, key)
+		if err != nil {
+			return utils.ErrInternalServer(errorMsg)
+		}
+		quota.Utilised -= existing.chargedSize
+		chargedSize = val.chargedSize(quota.Policy)
+		if err = validateQuota(quota, chargedSize); err != nil {
+			slog.Error("error validating object", "error", err.Error())
+			return err
+		}
+	}
+	{
+		tags, err := encodeTags(val.tags)
+		if err != nil {
+			slog.Error("error marshalling tags", "error", err)
+			return utils.ErrInternalServer(errorMsg)
+		}
+		now := time.Now().Unix()
+		createdAt, version := existing.next(now)
+		jsonCol, blobCol := val.columns()
+		_, err = tx.Exec("REPLACE INTO data_store (user_id, data_key, data_value, data_blob, is_json, encoding, encrypted, content_type, data_size, charged_size, tags, version, created_at, updated_at, ttl) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			userID, key, jsonCol, blobCol, val.isJSON, val.encoding, val.encrypted, val.contentType, val.size(), chargedSize, tags, version, createdAt, now, ttl)
+		if err != nil {
+			slog.Error("error creating object", "error", err)
+			return utils.ErrInternalServer(errorMsg)
+		}
+	}
+	if val.isJSON {
+		indexes, err := selectIndexes(tx, userID)
+		if err != nil {
+			return utils.ErrInternalServer(errorMsg)
+		}
+		if err = reindexObject(tx, userID, key, val.data, indexes); err != nil {
+			return utils.ErrInternalServer(errorMsg)
+		}
+	}
+	if err := updateUtilised(tx, userID, chargedSize-existing.chargedSize); err != nil {
+		return utils.ErrInternalServer(errorMsg)
+	}
+	return nil
+}
+
+// existingObject describes the row a write replaces. It is the zero value
+// when the key is new.
+type existingObject struct {
+	chargedSize int64
+	createdAt   int64
+	version     int64
+	ttl         int64
+}
+
+func (e existingObject) exists() bool {
+	return e.version > 0
+}
+
+// next returns the creation time and version of the row replacing it.
+func (e existingObject) next(now int64) (int64, int64) {
+	if e.createdAt == 0 {
+		return now, e.version + 1
+	}
+	return e.createdAt, e.version + 1
+}
+
+// selectExistingObject locks the object row, if any, and returns what a write
+// replacing it needs to know.
+func selectExistingObject(tx *sql.Tx, userID int, key string) (existingObject, error) {
+	var existing existingObject
+	err := tx.QueryRow("SELECT charged_size, created_at, version, ttl FROM data_store WHERE user_id = ? AND data_key = ? FOR UPDATE", userID, key).
+		Scan(&existing.chargedSize, &existing.createdAt, &existing.version, &existing.ttl)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		slog.Error("error getting object size", "error", err)
+		return existingObject{}, err
+	}
+	return existing, nil
 }
 
-func validateQuota(quota *types.Quota, value []byte) error {
-	if (quota.Utilised + int64(len(value))) > quota.Provisioned {
+func selectQuota(tx *sql.Tx, userID int) (*types.Quota, error) {
+	quota := &types.Quota{}
+	err := tx.QueryRow("SELECT q.provisioned, q.utilised, q.policy, u.plan FROM quotas q JOIN users u ON u.id = q.user_id WHERE q.user_id = ?", userID).
+		Scan(&quota.Provisioned, &quota.Utilised, &quota.Policy, &quota.Plan)
+	if err != nil {
+		slog.Error("error getting quota", "error", err)
+		return nil, err
+	}
+	return quota, nil
+}
+
+func updateUtilised(tx *sql.Tx, userID int, delta int64) error {
+	_, err := tx.Exec("UPDATE quotas SET utilised = utilised + ? WHERE user_id = ?", delta, userID)
+	if err != nil {
+		slog.Error("error updating quota", "error", err)
+	}
+	return err
+}
+
+func validateQuota(quota *types.Quota, size int64) error {
+	if (quota.Utilised + size) > quota.Provisioned {
 		return utils.ErrForbidden(utils.QuotaExceededErr)
 	}
-	if len(value) > maxValueSize {
+	return validateValueSize(quota, size)
+}
+
+// validateValueSize checks a value against the limit of the tenant's plan.
+func validateValueSize(quota *types.Quota, size int64) error {
+	if maxValueSize := plans.Get(quota.Plan).MaxValueSize; size > maxValueSize {
 		return utils.ErrBadRequest("value size exceeded, must be within %d bytes", maxValueSize)
 	}
 	return nil
 }
 
+// GetObject returns a JSON object with its decoded Value, or a binary object
+// with its raw bytes in Data and its ContentType. The bytes of chunked objects
+// are not loaded and have to be read with StreamObject.
 func (msDB *MysqlDB) GetObject(userID int, key string) (*types.Object, error) {
-	var valBytes []byte
+	row := &storedRow{}
+	var contentType string
+	var isJSON bool
 	obj := &types.Object{Key: key}
 
-	err := msDB.Db.QueryRow("SELECT data_value, ttl FROM data_store WHERE user_id = ? AND data_key = ?", userID, key).Scan(&valBytes, &obj.TTL)
+	var tags []byte
+	err := msDB.Db.QueryRow("SELECT data_value, data_blob, encoding, encrypted, is_json, content_type, data_size, chunked, tags, created_at, updated_at, ttl FROM data_store WHERE user_id = ? AND data_key = ?", userID, key).
+		Scan(&row.json, &row.blob, &row.encoding, &row.encrypted, &isJSON, &contentType, &obj.Size, &obj.Chunked, &tags, &obj.CreatedAt, &obj.UpdatedAt, &obj.TTL)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, utils.ErrNotFound(utils.ObjectNotFoundErr)
@@ -147,6 +315,24 @@ func (msDB *MysqlDB) GetObject(userID int, key string) (*types.Object, error) {
 		slog.Error("error getting object", "error", err)
 		return nil, utils.ErrInternalServer(utils.ObjectGetErr)
 	}
+	if obj.Tags, err = decodeTags(tags); err != nil {
+		slog.Error("error unmarshalling tags", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	if obj.Chunked {
+		obj.ContentType = contentType
+		return obj, nil
+	}
+
+	valBytes, err := msDB.loadValue(userID, key, row)
+	if err != nil {
+		slog.Error("error decoding value", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	if !isJSON {
+		obj.Data, obj.ContentType = valBytes, contentType
+		return obj, nil
+	}
 	err = json.Unmarshal(valBytes, &obj.Value)
 	if err != nil {
 		slog.Error("error unmarshalling value", "error", err)
@@ -155,12 +341,93 @@ func (msDB *MysqlDB) GetObject(userID int, key string) (*types.Object, error) {
 	return obj, nil
 }
 
+// GetObjectMetadata reads everything about an object except its value, so the
+// value columns are never loaded.
+func (msDB *MysqlDB) GetObjectMetadata(userID int, key string) (*types.ObjectMetadata, error) {
+	var tags []byte
+	meta := &types.ObjectMetadata{Key: key}
+
+	err := msDB.Db.QueryRow("SELECT data_size, version, content_type, tags, created_at, updated_at, ttl FROM data_store WHERE user_id = ? AND data_key = ?", userID, key).
+		Scan(&meta.Size, &meta.Version, &meta.ContentType, &tags, &meta.CreatedAt, &meta.UpdatedAt, &meta.TTL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.ObjectNotFoundErr)
+		}
+		slog.Error("error getting object metadata", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	if meta.Tags, err = decodeTags(tags); err != nil {
+		slog.Error("error unmarshalling tags", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	return meta, nil
+}
+
+// ScanObjects returns up to limit live JSON objects whose key starts with prefix,
+// that carry all of the given tags and sort after the given key, in key order.
+// Binary objects are skipped.
+func (msDB *MysqlDB) ScanObjects(userID int, prefix string, tags map[string]string, after string, limit int) ([]*types.Object, error) {
+	where := "user_id = ? AND data_key LIKE ? AND data_key > ? AND (ttl = 0 OR ttl >= ?) AND is_json = TRUE"
+	args := []any{userID, escapeLike(prefix) + "%", after, time.Now().Unix()}
+	if len(tags) > 0 {
+		tagBytes, err := encodeTags(tags)
+		if err != nil {
+			slog.Error("error marshalling tags", "error", err)
+			return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+		}
+		where += " AND JSON_CONTAINS(tags, ?)"
+		args = append(args, tagBytes)
+	}
+	args = append(args, limit)
+
+	rows, err := msDB.Db.Query("SELECT data_key, data_value, data_blob, encoding, encrypted, tags, created_at, updated_at, ttl FROM data_store WHERE "+where+" ORDER BY data_key LIMIT ?", args...)
+	if err != nil {
+		slog.Error("error scanning objects", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+	}
+	defer rows.Close()
+
+	objs := make([]*types.Object, 0, limit)
+	for rows.Next() {
+		row := &storedRow{}
+		var tags []byte
+		obj := &types.Object{}
+		if err := rows.Scan(&obj.Key, &row.json, &row.blob, &row.encoding, &row.encrypted, &tags, &obj.CreatedAt, &obj.UpdatedAt, &obj.TTL); err != nil {
+			slog.Error("error scanning object", "error", err)
+			return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+		}
+		if obj.Tags, err = decodeTags(tags); err != nil {
+			slog.Error("error unmarshalling tags", "error", err)
+			return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+		}
+		valBytes, err := msDB.loadValue(userID, obj.Key, row)
+		if err != nil {
+			slog.Error("error decoding value", "error", err)
+			return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+		}
+		if err := json.Unmarshal(valBytes, &obj.Value); err != nil {
+			slog.Error("error unmarshalling value", "error", err)
+			return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+		}
+		objs = append(objs, obj)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error scanning objects", "error", err)
+		return nil, utils.ErrInternalServer(utils.ObjectScanErr)
+	}
+	return objs, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
+
 func (msDB *MysqlDB) DeleteObject(userID int, key string) error {
 	return msDB.withTransaction("object deletion", utils.ObjectDeleteErr, nil, func(tx *sql.Tx) error {
-		var valBytes []byte
+		var size int64
 		{
-			err := tx.QueryRow("SELECT data_value FROM data_store WHERE user_id = ? AND data_key = ?", userID, key).
-				Scan(&valBytes)
+			err := tx.QueryRow("SELECT charged_size FROM data_store WHERE user_id = ? AND data_key = ?", userID, key).
+				Scan(&size)
 			if err != nil {
 				if errors.Is(err, sql.ErrNoRows) {
 					return nil
@@ -177,7 +444,7 @@ func (msDB *MysqlDB) DeleteObject(userID int, key string) error {
 			}
 		}
 		{
-			_, err := tx.Exec("UPDATE quotas SET utilised = utilised - ? WHERE user_id = ?", len(valBytes), userID)
+			_, err := tx.Exec("UPDATE quotas SET utilised = utilised - ? WHERE user_id = ?", size, userID)
 			if err != nil {
 				slog.Error("error updating quota", "error", err)
 				return utils.ErrInternalServer(utils.ObjectDeleteErr)
@@ -189,28 +456,86 @@ func (msDB *MysqlDB) DeleteObject(userID int, key string) error {
 
 func (msDB *MysqlDB) BatchCreateObject(userID int, objs []*types.Object) (err error) {
 	return msDB.withTransaction("batch object creation", utils.ObjectBatchCreateErr, utils.ErrStatusCreated(utils.ObjectCreated), func(tx *sql.Tx) error {
-		quota := &types.Quota{}
-
-		err = tx.QueryRow("SELECT provisioned, utilised FROM quotas WHERE user_id = ?", userID).Scan(&quota.Provisioned, &quota.Utilised)
+		quota, err := selectQuota(tx, userID)
 		if err != nil {
-			slog.Error("error getting quota", "error", err)
 			return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
 		}
 
-		batchSize, queryPlaceholders, queryArgs, err := server.ValidateAndPrepareBatchRequest(userID, objs, quota.Provisioned-quota.Utilised)
+		existingSize, existing, err := selectExistingObjects(tx, userID, objs)
 		if err != nil {
+			return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+		}
+
+		{
+			schemas, err := newSchemaValidator(tx, userID)
+			if err != nil {
+				return err
+			}
+			for _, obj := range objs {
+				if err := schemas.validate(obj.Key, obj.Value); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err = server.ValidateAndPrepareBatchRequest(objs, plans.Get(quota.Plan).MaxBatchSize); err != nil {
 			slog.Error("error validating and preparing batch request", "error", err.Error())
 			return err
 		}
 
-		query := fmt.Sprintf("REPLACE INTO data_store (user_id, data_key, data_value, ttl) VALUES %s", strings.Join(queryPlaceholders, ","))
+		var batchSize int64
+		now := time.Now().Unix()
+		queryPlaceholders := make([]string, len(objs))
+		queryArgs := make([]any, 0, len(objs)*15)
+		for idx, obj := range objs {
+			val := jsonValue(obj.Value.([]byte))
+			if err = validateValueSize(quota, val.size()); err != nil {
+				return err
+			}
+			if err = msDB.compress(val); err != nil {
+				slog.Error("error compressing value", "error", err)
+				return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+			}
+			if err = msDB.encrypt(userID, obj.Key, val); err != nil {
+				slog.Error("error encrypting value", "error", err)
+				return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+			}
+			chargedSize := val.chargedSize(quota.Policy)
+			batchSize += chargedSize
+
+			tags, err := encodeTags(obj.Tags)
+			if err != nil {
+				slog.Error("error marshalling tags", "error", err)
+				return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+			}
+			createdAt, version := existing[obj.Key].next(now)
+
+			jsonCol, blobCol := val.columns()
+			queryPlaceholders[idx] = "(?, ?, ?, ?, TRUE, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			queryArgs = append(queryArgs, userID, obj.Key, jsonCol, blobCol, val.encoding, val.encrypted, val.contentType, val.size(), chargedSize, tags, version, createdAt, now, obj.TTL)
+		}
+		if batchSize > quota.Provisioned-quota.Utilised+existingSize {
+			return utils.ErrForbidden(utils.QuotaExceededErr)
+		}
+
+		query := fmt.Sprintf("REPLACE INTO data_store (user_id, data_key, data_value, data_blob, is_json, encoding, encrypted, content_type, data_size, charged_size, tags, version, created_at, updated_at, ttl) VALUES %s", strings.Join(queryPlaceholders, ","))
 		_, err = tx.Exec(query, queryArgs...)
 		if err != nil {
 			slog.Error("error executing batch create object", "error", err)
 			return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
 		}
 
-		_, err = tx.Exec("UPDATE quotas SET utilised = utilised + ? WHERE user_id = ?", batchSize, userID)
+		indexes, err := selectIndexes(tx, userID)
+		if err != nil {
+			return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+		}
+		for _, obj := range objs {
+			if err = reindexObject(tx, userID, obj.Key, obj.Value.([]byte), indexes); err != nil {
+				return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
+			}
+		}
+
+		_, err = tx.Exec("UPDATE quotas SET utilised = utilised + ? WHERE user_id = ?", batchSize-existingSize, userID)
 		if err != nil {
 			slog.Error("error updating quota", "error", err)
 			return utils.ErrInternalServer(utils.ObjectBatchCreateErr)
@@ -219,6 +544,154 @@ func (msDB *MysqlDB) BatchCreateObject(userID int, objs []*types.Object) (err er
 	})
 }
 
+// selectExistingObjects locks the existing objects overwritten by a batch and
+// returns the total size charged for them along with each of them by key.
+func selectExistingObjects(tx *sql.Tx, userID int, objs []*types.Object) (int64, map[string]existingObject, error) {
+	existing := make(map[string]existingObject)
+	if len(objs) == 0 {
+		return 0, existing, nil
+	}
+	placeholders := make([]string, len(objs))
+	args := []any{userID}
+	for idx, obj := range objs {
+		placeholders[idx] = "?"
+		args = append(args, obj.Key)
+	}
+
+	query := fmt.Sprintf("SELECT data_key, charged_size, created_at, version, ttl FROM data_store WHERE user_id = ? AND data_key IN (%s) FOR UPDATE", strings.Join(placeholders, ","))
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		slog.Error("error getting batch size", "error", err)
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var size int64
+	for rows.Next() {
+		var key string
+		var obj existingObject
+		if err := rows.Scan(&key, &obj.chargedSize, &obj.createdAt, &obj.version, &obj.ttl); err != nil {
+			slog.Error("error getting batch size", "error", err)
+			return 0, nil, err
+		}
+		size += obj.chargedSize
+		existing[key] = obj
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error getting batch size", "error", err)
+		return 0, nil, err
+	}
+	return size, existing, nil
+}
+
+func (msDB *MysqlDB) CompareAndSwapObject(userID int, obj *types.Object, expected json.RawMessage) error {
+	return msDB.withTransaction("object compare and swap", utils.ObjectCASErr, utils.ErrStatusOK(utils.ObjectUpdated), func(tx *sql.Tx) error {
+		var tags []byte
+		{
+			row := &storedRow{}
+			var isJSON bool
+			var storedTTL int64
+			err := tx.QueryRow("SELECT data_value, data_blob, encoding, encrypted, is_json, tags, ttl FROM data_store WHERE user_id = ? AND data_key = ? FOR UPDATE", userID, obj.Key).
+				Scan(&row.json, &row.blob, &row.encoding, &row.encrypted, &isJSON, &tags, &storedTTL)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return utils.ErrNotFound(utils.ObjectNotFoundErr)
+				}
+				slog.Error("error getting object", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCASErr)
+			}
+			if isExpired(storedTTL) {
+				return utils.ErrNotFound(utils.ObjectNotFoundErr)
+			}
+			if !isJSON {
+				return utils.ErrConflict(utils.ObjectCASMismatchErr)
+			}
+
+			storedBytes, err := msDB.loadValue(userID, obj.Key, row)
+			if err != nil {
+				slog.Error("error decoding value", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCASErr)
+			}
+
+			matches, err := jsonEqual(storedBytes, expected)
+			if err != nil {
+				slog.Error("error comparing values", "error", err)
+				return utils.ErrInternalServer(utils.ObjectCASErr)
+			}
+			if !matches {
+				return utils.ErrConflict(utils.ObjectCASMismatchErr)
+			}
+		}
+
+		valBytes, err := json.Marshal(obj.Value)
+		if err != nil {
+			slog.Error("error marshalling value", "error", err)
+			return utils.ErrInternalServer(utils.ObjectCASErr)
+		}
+		// A swap replaces the value but keeps the tags.
+		val := jsonValue(valBytes)
+		if val.tags, err = decodeTags(tags); err != nil {
+			slog.Error("error unmarshalling tags", "error", err)
+			return utils.ErrInternalServer(utils.ObjectCASErr)
+		}
+		return msDB.putObject(tx, userID, obj.Key, val, obj.TTL, utils.ObjectCASErr)
+	})
+}
+
+// encodeTags returns the tags column of an object, NULL when it has no tags.
+func encodeTags(tags map[string]string) ([]byte, error) {
+	if len(tags) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(tags)
+}
+
+func decodeTags(tags []byte) (map[string]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(tags, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+// isExpired reports whether a unix ttl has passed. A zero ttl never expires.
+func isExpired(ttl int64) bool {
+	return ttl != 0 && ttl < time.Now().Unix()
+}
+
+// jsonEqual reports whether the stored JSON document is semantically equal to
+// expected, ignoring key order and formatting differences. Numbers are
+// compared as written, so that integers beyond the precision of float64 are
+// not mistaken for each other. A missing expected document is null.
+func jsonEqual(stored, expected []byte) (bool, error) {
+	if len(expected) == 0 {
+		expected = []byte("null")
+	}
+	storedVal, err := decodeExact(stored)
+	if err != nil {
+		return false, err
+	}
+	expectedVal, err := decodeExact(expected)
+	if err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(storedVal, expectedVal), nil
+}
+
+// decodeExact decodes a JSON document with its numbers as json.Number.
+func decodeExact(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var val any
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	return val, nil
+}
+
 func (msDB *MysqlDB) withTransaction(operation, errorMsg string, successCode error, fn func(*sql.Tx) error) error {
 	tx, err := msDB.Db.Begin()
 	if err != nil {
@@ -0,0 +1,183 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func (msDB *MysqlDB) Enqueue(userID int, queue string, msg *types.QueueMessage) error {
+	return msDB.withTransaction("message enqueue", utils.QueueEnqueueErr, nil, func(tx *sql.Tx) error {
+		var valBytes []byte
+		{
+			quota, err := selectQuota(tx, userID)
+			if err != nil {
+				return utils.ErrInternalServer(utils.QueueEnqueueErr)
+			}
+			valBytes, err = json.Marshal(msg.Value)
+			if err != nil {
+				slog.Error("error marshalling value", "error", err)
+				return utils.ErrInternalServer(utils.QueueEnqueueErr)
+			}
+			if err = validateQuota(quota, int64(len(valBytes))); err != nil {
+				slog.Error("error validating message", "error", err.Error())
+				return err
+			}
+		}
+		{
+			res, err := tx.Exec("INSERT INTO queue_messages (user_id, queue_name, body, size, max_deliveries) VALUES (?, ?, ?, ?, ?)",
+				userID, queue, valBytes, len(valBytes), msg.MaxDeliveries)
+			if err != nil {
+				slog.Error("error enqueuing message", "error", err)
+				return utils.ErrInternalServer(utils.QueueEnqueueErr)
+			}
+			msg.ID, _ = res.LastInsertId()
+		}
+		if err := updateUtilised(tx, userID, int64(len(valBytes))); err != nil {
+			return utils.ErrInternalServer(utils.QueueEnqueueErr)
+		}
+		return nil
+	})
+}
+
+// Dequeue hands out the oldest visible message and hides it until visibleAt.
+// Messages whose visibility timed out after their last allowed delivery are
+// moved to the dead letter queue first. A nil message means the queue is empty.
+func (msDB *MysqlDB) Dequeue(userID int, queue string, visibleAt int64) (*types.QueueMessage, error) {
+	var msg *types.QueueMessage
+	err := msDB.withTransaction("message dequeue", utils.QueueDequeueErr, nil, func(tx *sql.Tx) error {
+		now := time.Now().Unix()
+		{
+			_, err := tx.Exec("UPDATE queue_messages SET dead_lettered = TRUE, receipt = NULL WHERE user_id = ? AND queue_name = ? AND dead_lettered = FALSE AND deliveries >= max_deliveries AND visible_at <= ?",
+				userID, queue, now)
+			if err != nil {
+				slog.Error("error dead lettering messages", "error", err)
+				return utils.ErrInternalServer(utils.QueueDequeueErr)
+			}
+		}
+		var valBytes []byte
+		candidate := &types.QueueMessage{}
+		{
+			err := tx.QueryRow("SELECT id, body, deliveries, max_deliveries FROM queue_messages WHERE user_id = ? AND queue_name = ? AND dead_lettered = FALSE AND visible_at <= ? ORDER BY id LIMIT 1 FOR UPDATE SKIP LOCKED",
+				userID, queue, now).Scan(&candidate.ID, &valBytes, &candidate.Deliveries, &candidate.MaxDeliveries)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return nil
+				}
+				slog.Error("error dequeuing message", "error", err)
+				return utils.ErrInternalServer(utils.QueueDequeueErr)
+			}
+			if err = json.Unmarshal(valBytes, &candidate.Value); err != nil {
+				slog.Error("error unmarshalling value", "error", err)
+				return utils.ErrInternalServer(utils.QueueDequeueErr)
+			}
+		}
+		{
+			receipt, err := utils.RandomToken(16)
+			if err != nil {
+				slog.Error("error generating receipt", "error", err)
+				return utils.ErrInternalServer(utils.QueueDequeueErr)
+			}
+			_, err = tx.Exec("UPDATE queue_messages SET deliveries = deliveries + 1, visible_at = ?, receipt = ? WHERE id = ?", visibleAt, receipt, candidate.ID)
+			if err != nil {
+				slog.Error("error dequeuing message", "error", err)
+				return utils.ErrInternalServer(utils.QueueDequeueErr)
+			}
+			candidate.Deliveries++
+			candidate.Receipt = receipt
+		}
+		msg = candidate
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// AckMessage deletes a delivered message. The receipt must belong to the most
+// recent delivery and its visibility timeout must not have passed.
+func (msDB *MysqlDB) AckMessage(userID int, queue string, id int64, receipt string) error {
+	return msDB.withTransaction("message acknowledgement", utils.QueueAckErr, nil, func(tx *sql.Tx) error {
+		var size, visibleAt int64
+		var storedReceipt sql.NullString
+		{
+			err := tx.QueryRow("SELECT size, visible_at, receipt FROM queue_messages WHERE id = ? AND user_id = ? AND queue_name = ? AND dead_lettered = FALSE FOR UPDATE",
+				id, userID, queue).Scan(&size, &visibleAt, &storedReceipt)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return utils.ErrNotFound(utils.MessageNotFoundErr)
+				}
+				slog.Error("error acknowledging message", "error", err)
+				return utils.ErrInternalServer(utils.QueueAckErr)
+			}
+			if !storedReceipt.Valid || storedReceipt.String != receipt || visibleAt < time.Now().Unix() {
+				return utils.ErrConflict(utils.InvalidReceiptErr)
+			}
+		}
+		return deleteMessage(tx, userID, id, size, utils.QueueAckErr)
+	})
+}
+
+func (msDB *MysqlDB) ListDeadLetters(userID int, queue string, limit int) ([]*types.QueueMessage, error) {
+	rows, err := msDB.Db.Query("SELECT id, body, deliveries, max_deliveries FROM queue_messages WHERE user_id = ? AND queue_name = ? AND dead_lettered = TRUE ORDER BY id LIMIT ?",
+		userID, queue, limit)
+	if err != nil {
+		slog.Error("error listing dead letters", "error", err)
+		return nil, utils.ErrInternalServer(utils.QueueGetErr)
+	}
+	defer rows.Close()
+
+	msgs := make([]*types.QueueMessage, 0)
+	for rows.Next() {
+		var valBytes []byte
+		msg := &types.QueueMessage{}
+		if err := rows.Scan(&msg.ID, &valBytes, &msg.Deliveries, &msg.MaxDeliveries); err != nil {
+			slog.Error("error scanning dead letter", "error", err)
+			return nil, utils.ErrInternalServer(utils.QueueGetErr)
+		}
+		if err := json.Unmarshal(valBytes, &msg.Value); err != nil {
+			slog.Error("error unmarshalling value", "error", err)
+			return nil, utils.ErrInternalServer(utils.QueueGetErr)
+		}
+		msgs = append(msgs, msg)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error listing dead letters", "error", err)
+		return nil, utils.ErrInternalServer(utils.QueueGetErr)
+	}
+	return msgs, nil
+}
+
+func (msDB *MysqlDB) DeleteDeadLetter(userID int, queue string, id int64) error {
+	return msDB.withTransaction("dead letter deletion", utils.QueueAckErr, nil, func(tx *sql.Tx) error {
+		var size int64
+		err := tx.QueryRow("SELECT size FROM queue_messages WHERE id = ? AND user_id = ? AND queue_name = ? AND dead_lettered = TRUE FOR UPDATE",
+			id, userID, queue).Scan(&size)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return utils.ErrNotFound(utils.MessageNotFoundErr)
+			}
+			slog.Error("error deleting dead letter", "error", err)
+			return utils.ErrInternalServer(utils.QueueAckErr)
+		}
+		return deleteMessage(tx, userID, id, size, utils.QueueAckErr)
+	})
+}
+
+func deleteMessage(tx *sql.Tx, userID int, id, size int64, errorMsg string) error {
+	_, err := tx.Exec("DELETE FROM queue_messages WHERE id = ?", id)
+	if err != nil {
+		slog.Error("error deleting message", "error", err)
+		return utils.ErrInternalServer(errorMsg)
+	}
+	if err := updateUtilised(tx, userID, -size); err != nil {
+		return utils.ErrInternalServer(errorMsg)
+	}
+	return nil
+}
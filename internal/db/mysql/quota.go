@@ -0,0 +1,19 @@
+package mysql
+
+import (
+	"log/slog"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func (msDB *MysqlDB) GetQuota(userID int) (*types.Quota, error) {
+	quota := &types.Quota{}
+	err := msDB.Db.QueryRow("SELECT q.provisioned, q.utilised, q.policy, u.plan FROM quotas q JOIN users u ON u.id = q.user_id WHERE q.user_id = ?", userID).
+		Scan(&quota.Provisioned, &quota.Utilised, &quota.Policy, &quota.Plan)
+	if err != nil {
+		slog.Error("error getting quota", "error", err)
+		return nil, utils.ErrInternalServer(utils.QuotaGetErr)
+	}
+	return quota, nil
+}
@@ -0,0 +1,140 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"strings"
+
+	"github.com/santhoshm25/key-value-ds/internal/jsonschema"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func (msDB *MysqlDB) PutSchema(userID int, schema *types.Schema) error {
+	doc, err := json.Marshal(schema.Schema)
+	if err != nil {
+		slog.Error("error marshalling schema", "error", err)
+		return utils.ErrInternalServer(utils.SchemaPutErr)
+	}
+
+	_, err = msDB.Db.Exec("REPLACE INTO prefix_schemas (user_id, prefix, schema_doc) VALUES (?, ?, ?)", userID, schema.Prefix, doc)
+	if err != nil {
+		slog.Error("error saving schema", "error", err)
+		return utils.ErrInternalServer(utils.SchemaPutErr)
+	}
+	return utils.ErrStatusOK(utils.SchemaSaved)
+}
+
+func (msDB *MysqlDB) ListSchemas(userID int) ([]*types.Schema, error) {
+	rows, err := msDB.Db.Query("SELECT prefix, schema_doc FROM prefix_schemas WHERE user_id = ? ORDER BY prefix", userID)
+	if err != nil {
+		slog.Error("error listing schemas", "error", err)
+		return nil, utils.ErrInternalServer(utils.SchemaGetErr)
+	}
+	return scanSchemas(rows)
+}
+
+func scanSchemas(rows *sql.Rows) ([]*types.Schema, error) {
+	defer rows.Close()
+
+	schemas := make([]*types.Schema, 0)
+	for rows.Next() {
+		var doc []byte
+		schema := &types.Schema{}
+		if err := rows.Scan(&schema.Prefix, &doc); err != nil {
+			slog.Error("error scanning schema", "error", err)
+			return nil, utils.ErrInternalServer(utils.SchemaGetErr)
+		}
+		if err := json.Unmarshal(doc, &schema.Schema); err != nil {
+			slog.Error("error unmarshalling schema", "error", err)
+			return nil, utils.ErrInternalServer(utils.SchemaGetErr)
+		}
+		schemas = append(schemas, schema)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error listing schemas", "error", err)
+		return nil, utils.ErrInternalServer(utils.SchemaGetErr)
+	}
+	return schemas, nil
+}
+
+func (msDB *MysqlDB) DeleteSchema(userID int, prefix string) error {
+	res, err := msDB.Db.Exec("DELETE FROM prefix_schemas WHERE user_id = ? AND prefix = ?", userID, prefix)
+	if err != nil {
+		slog.Error("error deleting schema", "error", err)
+		return utils.ErrInternalServer(utils.SchemaDeleteErr)
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return utils.ErrNotFound(utils.SchemaNotFoundErr)
+	}
+	return nil
+}
+
+// schemaValidator checks the values of a write against the schemas of the
+// tenant, as read in the write's transaction.
+type schemaValidator struct {
+	schemas  []*types.Schema
+	compiled map[string]*jsonschema.Schema
+}
+
+// newSchemaValidator reads the schemas of the tenant with a shared lock, so
+// that a schema put concurrently waits for the write and no write commits
+// without checking a schema committed before it.
+func newSchemaValidator(tx *sql.Tx, userID int) (*schemaValidator, error) {
+	rows, err := tx.Query("SELECT prefix, schema_doc FROM prefix_schemas WHERE user_id = ? ORDER BY prefix LOCK IN SHARE MODE", userID)
+	if err != nil {
+		slog.Error("error listing schemas", "error", err)
+		return nil, utils.ErrInternalServer(utils.SchemaGetErr)
+	}
+	schemas, err := scanSchemas(rows)
+	if err != nil {
+		return nil, err
+	}
+	return &schemaValidator{schemas: schemas, compiled: make(map[string]*jsonschema.Schema)}, nil
+}
+
+// match returns the schema registered for the longest prefix of key, or nil.
+func (v *schemaValidator) match(key string) *types.Schema {
+	var match *types.Schema
+	for _, schema := range v.schemas {
+		if strings.HasPrefix(key, schema.Prefix) && (match == nil || len(schema.Prefix) > len(match.Prefix)) {
+			match = schema
+		}
+	}
+	return match
+}
+
+// validate checks a decoded JSON value. Keys without a matching prefix are
+// not checked.
+func (v *schemaValidator) validate(key string, value any) error {
+	match := v.match(key)
+	if match == nil {
+		return nil
+	}
+	validator, ok := v.compiled[match.Prefix]
+	if !ok {
+		var err error
+		if validator, err = jsonschema.Compile(match.Schema); err != nil {
+			return utils.ErrInternalServer("invalid schema stored for prefix %q", match.Prefix)
+		}
+		v.compiled[match.Prefix] = validator
+	}
+	if err := validator.Validate(value); err != nil {
+		return utils.ErrBadRequest("value of key %q violates schema for prefix %q at %s", key, match.Prefix, err.Error())
+	}
+	return nil
+}
+
+// validateJSON is validate for a JSON encoded value.
+func (v *schemaValidator) validateJSON(key string, data []byte) error {
+	if v.match(key) == nil {
+		return nil
+	}
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		slog.Error("error unmarshalling value", "error", err)
+		return utils.ErrInternalServer(utils.SchemaGetErr)
+	}
+	return v.validate(key, value)
+}
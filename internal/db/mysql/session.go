@@ -0,0 +1,109 @@
+package mysql
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func (msDB *MysqlDB) CreateSession(session *types.Session) error {
+	scopes, err := encodeScopes(session.Scopes)
+	if err != nil {
+		slog.Error("error marshalling scopes", "error", err)
+		return utils.ErrInternalServer(utils.SessionCreateErr)
+	}
+	_, err = msDB.Db.Exec("INSERT INTO sessions (id, user_id, refresh_token_hash, expires_at, scopes) VALUES (?, ?, ?, ?, ?)",
+		session.ID, session.UserID, session.RefreshTokenHash, session.ExpiresAt, scopes)
+	if err != nil {
+		slog.Error("error creating session", "error", err)
+		return utils.ErrInternalServer(utils.SessionCreateErr)
+	}
+	return nil
+}
+
+// RotateSession replaces the refresh token of a live session, so that every
+// refresh token can be used only once, and returns the session.
+func (msDB *MysqlDB) RotateSession(refreshTokenHash, newRefreshTokenHash string) (*types.Session, error) {
+	session := &types.Session{}
+	err := msDB.withTransaction("session refresh", utils.SessionRefreshErr, nil, func(tx *sql.Tx) error {
+		{
+			var scopes []byte
+			err := tx.QueryRow("SELECT id, user_id, expires_at, revoked, scopes FROM sessions WHERE refresh_token_hash = ? FOR UPDATE", refreshTokenHash).
+				Scan(&session.ID, &session.UserID, &session.ExpiresAt, &session.Revoked, &scopes)
+			if err != nil {
+				if errors.Is(err, sql.ErrNoRows) {
+					return utils.ErrUnAuthorized(utils.InvalidRefreshErr)
+				}
+				slog.Error("error getting session", "error", err)
+				return utils.ErrInternalServer(utils.SessionRefreshErr)
+			}
+			if session.Revoked || isExpired(session.ExpiresAt) {
+				return utils.ErrUnAuthorized(utils.InvalidRefreshErr)
+			}
+			if session.Scopes, err = decodeScopes(scopes); err != nil {
+				slog.Error("error unmarshalling scopes", "error", err)
+				return utils.ErrInternalServer(utils.SessionRefreshErr)
+			}
+		}
+		{
+			_, err := tx.Exec("UPDATE sessions SET refresh_token_hash = ? WHERE id = ?", newRefreshTokenHash, session.ID)
+			if err != nil {
+				slog.Error("error rotating refresh token", "error", err)
+				return utils.ErrInternalServer(utils.SessionRefreshErr)
+			}
+		}
+		session.RefreshTokenHash = newRefreshTokenHash
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+func (msDB *MysqlDB) RevokeSession(userID int, id string) error {
+	_, err := msDB.Db.Exec("UPDATE sessions SET revoked = TRUE WHERE id = ? AND user_id = ?", id, userID)
+	if err != nil {
+		slog.Error("error revoking session", "error", err)
+		return utils.ErrInternalServer(utils.SessionRevokeErr)
+	}
+	return nil
+}
+
+func (msDB *MysqlDB) GetSession(id string) (*types.Session, error) {
+	session := &types.Session{ID: id}
+	err := msDB.Db.QueryRow("SELECT user_id, refresh_token_hash, expires_at, revoked FROM sessions WHERE id = ?", id).
+		Scan(&session.UserID, &session.RefreshTokenHash, &session.ExpiresAt, &session.Revoked)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.SessionRevokedErr)
+		}
+		slog.Error("error getting session", "error", err)
+		return nil, utils.ErrInternalServer(utils.SessionGetErr)
+	}
+	return session, nil
+}
+
+// encodeScopes returns the scopes column of a credential, NULL when it is
+// unrestricted.
+func encodeScopes(scopes []string) ([]byte, error) {
+	if len(scopes) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(scopes)
+}
+
+func decodeScopes(scopes []byte) ([]string, error) {
+	if scopes == nil {
+		return nil, nil
+	}
+	var decoded []string
+	if err := json.Unmarshal(scopes, &decoded); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
@@ -0,0 +1,313 @@
+package mysql
+
+import (
+	"database/sql"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+// Uploads that are not completed within uploadLifetime expire. Expired uploads
+// are rejected, and a sweep that runs every uploadSweepInterval deletes them
+// and refunds the quota charged for their parts.
+const (
+	uploadLifetime      = 24 * time.Hour
+	uploadSweepInterval = 10 * time.Minute
+)
+
+func (msDB *MysqlDB) CreateUpload(userID int, upload *types.Upload) error {
+	id, err := utils.RandomToken(16)
+	if err != nil {
+		slog.Error("error generating upload id", "error", err)
+		return utils.ErrInternalServer(utils.UploadCreateErr)
+	}
+
+	expiresAt := time.Now().Add(uploadLifetime).Unix()
+	_, err = msDB.Db.Exec("INSERT INTO uploads (id, user_id, data_key, content_type, ttl, expires_at) VALUES (?, ?, ?, ?, ?, ?)",
+		id, userID, upload.Key, upload.ContentType, upload.TTL, expiresAt)
+	if err != nil {
+		slog.Error("error creating upload", "error", err)
+		return utils.ErrInternalServer(utils.UploadCreateErr)
+	}
+	upload.ID, upload.ExpiresAt = id, expiresAt
+	return nil
+}
+
+// UploadPart stores a part of an upload, replacing any part previously sent
+// with the same number. Parts are charged against the quota as they arrive.
+func (msDB *MysqlDB) UploadPart(userID int, uploadID string, partNumber int, data []byte) error {
+	return msDB.withTransaction("part upload", utils.UploadPartErr, utils.ErrStatusOK(utils.PartUploaded), func(tx *sql.Tx) error {
+		upload, err := selectUploadForUpdate(tx, userID, uploadID, utils.UploadPartErr)
+		if err != nil {
+			return err
+		}
+
+		var existingSize int64
+		{
+			err := tx.QueryRow("SELECT size FROM upload_parts WHERE upload_id = ? AND part_number = ? FOR UPDATE", uploadID, partNumber).Scan(&existingSize)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				slog.Error("error getting part", "error", err)
+				return utils.ErrInternalServer(utils.UploadPartErr)
+			}
+		}
+		{
+			quota, err := selectQuota(tx, userID)
+			if err != nil {
+				return utils.ErrInternalServer(utils.UploadPartErr)
+			}
+			if quota.Utilised-existingSize+int64(len(data)) > quota.Provisioned {
+				return utils.ErrForbidden(utils.QuotaExceededErr)
+			}
+		}
+		{
+			// Parts are sealed for the key of the object, which their chunks
+			// are stored under once the upload is completed.
+			stored, encrypted := data, msDB.keyring != nil
+			if encrypted {
+				var err error
+				if stored, err = msDB.seal(userID, upload.Key, data); err != nil {
+					slog.Error("error encrypting part", "error", err)
+					return utils.ErrInternalServer(utils.UploadPartErr)
+				}
+			}
+			_, err := tx.Exec("REPLACE INTO upload_parts (upload_id, part_number, data, encrypted, size) VALUES (?, ?, ?, ?, ?)",
+				uploadID, partNumber, stored, encrypted, len(data))
+			if err != nil {
+				slog.Error("error uploading part", "error", err)
+				return utils.ErrInternalServer(utils.UploadPartErr)
+			}
+		}
+		if err := updateUtilised(tx, userID, int64(len(data))-existingSize); err != nil {
+			return utils.ErrInternalServer(utils.UploadPartErr)
+		}
+		return nil
+	})
+}
+
+// CompleteUpload assembles the parts, in part number order, into a chunked
+// object. The quota already charged for the parts moves to the object.
+func (msDB *MysqlDB) CompleteUpload(userID int, uploadID string) error {
+	return msDB.withTransaction("upload completion", utils.UploadCompleteErr, utils.ErrStatusCreated(utils.ObjectCreated), func(tx *sql.Tx) error {
+		upload, err := selectUploadForUpdate(tx, userID, uploadID, utils.UploadCompleteErr)
+		if err != nil {
+			return err
+		}
+
+		var partNumbers []int
+		var partSizes []int64
+		var totalSize int64
+		{
+			rows, err := tx.Query("SELECT part_number, size FROM upload_parts WHERE upload_id = ? ORDER BY part_number", uploadID)
+			if err != nil {
+				slog.Error("error getting parts", "error", err)
+				return utils.ErrInternalServer(utils.UploadCompleteErr)
+			}
+			for rows.Next() {
+				var number int
+				var size int64
+				if err := rows.Scan(&number, &size); err != nil {
+					rows.Close()
+					slog.Error("error scanning part", "error", err)
+					return utils.ErrInternalServer(utils.UploadCompleteErr)
+				}
+				partNumbers = append(partNumbers, number)
+				partSizes = append(partSizes, size)
+				totalSize += size
+			}
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				slog.Error("error getting parts", "error", err)
+				return utils.ErrInternalServer(utils.UploadCompleteErr)
+			}
+			if len(partNumbers) == 0 {
+				return utils.ErrBadRequest(utils.UploadEmptyErr)
+			}
+		}
+
+		existing, err := selectExistingObject(tx, userID, upload.Key)
+		if err != nil {
+			return utils.ErrInternalServer(utils.UploadCompleteErr)
+		}
+		{
+			now := time.Now().Unix()
+			createdAt, version := existing.next(now)
+			_, err := tx.Exec("REPLACE INTO data_store (user_id, data_key, content_type, data_size, charged_size, chunked, version, created_at, updated_at, ttl) VALUES (?, ?, ?, ?, ?, TRUE, ?, ?, ?, ?)",
+				userID, upload.Key, upload.ContentType, totalSize, totalSize, version, createdAt, now, upload.TTL)
+			if err != nil {
+				slog.Error("error creating object", "error", err)
+				return utils.ErrInternalServer(utils.UploadCompleteErr)
+			}
+		}
+		{
+			var offset int64
+			for idx, number := range partNumbers {
+				_, err := tx.Exec("INSERT INTO object_chunks (user_id, data_key, chunk_offset, data, encrypted, size) SELECT ?, ?, ?, data, encrypted, size FROM upload_parts WHERE upload_id = ? AND part_number = ?",
+					userID, upload.Key, offset, uploadID, number)
+				if err != nil {
+					slog.Error("error copying part", "error", err)
+					return utils.ErrInternalServer(utils.UploadCompleteErr)
+				}
+				offset += partSizes[idx]
+			}
+		}
+		{
+			_, err := tx.Exec("DELETE FROM uploads WHERE id = ?", uploadID)
+			if err != nil {
+				slog.Error("error deleting upload", "error", err)
+				return utils.ErrInternalServer(utils.UploadCompleteErr)
+			}
+		}
+		if err := updateUtilised(tx, userID, -existing.chargedSize); err != nil {
+			return utils.ErrInternalServer(utils.UploadCompleteErr)
+		}
+		return nil
+	})
+}
+
+// AbortUpload discards an upload and refunds the quota charged for its parts.
+func (msDB *MysqlDB) AbortUpload(userID int, uploadID string) error {
+	return msDB.withTransaction("upload abort", utils.UploadAbortErr, nil, func(tx *sql.Tx) error {
+		if _, err := selectUploadForUpdate(tx, userID, uploadID, utils.UploadAbortErr); err != nil {
+			return err
+		}
+		if err := discardUpload(tx, userID, uploadID); err != nil {
+			return utils.ErrInternalServer(utils.UploadAbortErr)
+		}
+		return nil
+	})
+}
+
+// sweepUploads expires abandoned uploads until the process exits.
+func (msDB *MysqlDB) sweepUploads() {
+	for range time.Tick(uploadSweepInterval) {
+		msDB.expireUploads()
+	}
+}
+
+// expireUploads discards the uploads past their expiry and refunds the quota
+// charged for their parts. Each upload is discarded in its own transaction,
+// which checks the expiry again, so uploads completed or aborted in the
+// meantime are left alone.
+func (msDB *MysqlDB) expireUploads() {
+	now := time.Now().Unix()
+	var uploadIDs []string
+	{
+		rows, err := msDB.Db.Query("SELECT id FROM uploads WHERE expires_at <= ?", now)
+		if err != nil {
+			slog.Error("error getting expired uploads", "error", err)
+			return
+		}
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				slog.Error("error scanning expired upload", "error", err)
+				return
+			}
+			uploadIDs = append(uploadIDs, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			slog.Error("error getting expired uploads", "error", err)
+			return
+		}
+	}
+
+	for _, uploadID := range uploadIDs {
+		err := msDB.withTransaction("upload expiry", utils.UploadExpireErr, nil, func(tx *sql.Tx) error {
+			var userID int
+			err := tx.QueryRow("SELECT user_id FROM uploads WHERE id = ? AND expires_at <= ? FOR UPDATE", uploadID, now).Scan(&userID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return nil
+			}
+			if err != nil {
+				slog.Error("error getting upload", "error", err)
+				return utils.ErrInternalServer(utils.UploadExpireErr)
+			}
+			if err := discardUpload(tx, userID, uploadID); err != nil {
+				return utils.ErrInternalServer(utils.UploadExpireErr)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.Error("error expiring upload", "upload", uploadID, "error", err)
+		}
+	}
+	if len(uploadIDs) > 0 {
+		slog.Info("expired uploads", "uploads", len(uploadIDs))
+	}
+}
+
+// discardUpload deletes an upload with its parts and refunds their quota.
+func discardUpload(tx *sql.Tx, userID int, uploadID string) error {
+	var size int64
+	if err := tx.QueryRow("SELECT COALESCE(SUM(size), 0) FROM upload_parts WHERE upload_id = ?", uploadID).Scan(&size); err != nil {
+		slog.Error("error getting upload size", "error", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM uploads WHERE id = ?", uploadID); err != nil {
+		slog.Error("error deleting upload", "error", err)
+		return err
+	}
+	return updateUtilised(tx, userID, -size)
+}
+
+// StreamObject writes the bytes in [start, end] of a binary object to w, one
+// chunk at a time for chunked objects.
+func (msDB *MysqlDB) StreamObject(userID int, key string, start, end int64, w io.Writer) error {
+	rows, err := msDB.Db.Query("SELECT chunk_offset, data, encrypted FROM object_chunks WHERE user_id = ? AND data_key = ? AND chunk_offset <= ? AND chunk_offset + size > ? ORDER BY chunk_offset",
+		userID, key, end, start)
+	if err != nil {
+		slog.Error("error reading chunks", "error", err)
+		return utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var offset int64
+		var data []byte
+		var encrypted bool
+		if err := rows.Scan(&offset, &data, &encrypted); err != nil {
+			slog.Error("error scanning chunk", "error", err)
+			return utils.ErrInternalServer(utils.ObjectGetErr)
+		}
+		if encrypted {
+			if data, err = msDB.open(userID, key, data); err != nil {
+				slog.Error("error decrypting chunk", "error", err)
+				return utils.ErrInternalServer(utils.ObjectGetErr)
+			}
+		}
+
+		from := max(start-offset, 0)
+		to := min(end-offset+1, int64(len(data)))
+		if _, err := w.Write(data[from:to]); err != nil {
+			slog.Error("error writing chunk", "error", err)
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("error reading chunks", "error", err)
+		return utils.ErrInternalServer(utils.ObjectGetErr)
+	}
+	return nil
+}
+
+// selectUploadForUpdate locks an upload of the tenant. Expired uploads are
+// not found, though the sweep may not have discarded them yet.
+func selectUploadForUpdate(tx *sql.Tx, userID int, uploadID, errorMsg string) (*types.Upload, error) {
+	upload := &types.Upload{ID: uploadID}
+	err := tx.QueryRow("SELECT data_key, content_type, ttl, expires_at FROM uploads WHERE id = ? AND user_id = ? AND expires_at > ? FOR UPDATE", uploadID, userID, time.Now().Unix()).
+		Scan(&upload.Key, &upload.ContentType, &upload.TTL, &upload.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, utils.ErrNotFound(utils.UploadNotFoundErr)
+		}
+		slog.Error("error getting upload", "error", err)
+		return nil, utils.ErrInternalServer(errorMsg)
+	}
+	return upload, nil
+}
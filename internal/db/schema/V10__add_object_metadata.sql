@@ -0,0 +1,6 @@
+ALTER TABLE data_store
+    ADD COLUMN tags JSON,
+    ADD COLUMN created_at BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN updated_at BIGINT NOT NULL DEFAULT 0;
+
+UPDATE data_store SET created_at = UNIX_TIMESTAMP(), updated_at = UNIX_TIMESTAMP();
@@ -0,0 +1 @@
+ALTER TABLE data_store ADD COLUMN version BIGINT NOT NULL DEFAULT 1;
@@ -0,0 +1,31 @@
+-- Keys may be up to 1024 bytes. The application limits them to printable
+-- ASCII, so an ASCII binary collation keeps the primary keys within the InnoDB
+-- index size limit. Keys are now compared case sensitively.
+--
+-- Keys and prefixes stored earlier may hold characters outside ASCII, which
+-- the conversion would fail on or replace. The migration stops instead, and
+-- those keys have to be renamed or deleted first.
+DELIMITER //
+CREATE PROCEDURE check_ascii_keys()
+BEGIN
+    IF EXISTS (SELECT 1 FROM data_store WHERE HEX(data_key) NOT REGEXP '^([0-7][0-9A-F])*$')
+        OR EXISTS (SELECT 1 FROM uploads WHERE HEX(data_key) NOT REGEXP '^([0-7][0-9A-F])*$')
+        OR EXISTS (SELECT 1 FROM prefix_schemas WHERE HEX(prefix) NOT REGEXP '^([0-7][0-9A-F])*$') THEN
+        SIGNAL SQLSTATE '45000'
+            SET MESSAGE_TEXT = 'Keys or schema prefixes with non-ASCII characters exist. Rename or delete them before migrating.';
+    END IF;
+END //
+DELIMITER ;
+
+CALL check_ascii_keys();
+DROP PROCEDURE check_ascii_keys;
+
+SET FOREIGN_KEY_CHECKS = 0;
+
+ALTER TABLE data_store MODIFY data_key VARCHAR(1024) CHARACTER SET ascii COLLATE ascii_bin;
+ALTER TABLE index_entries MODIFY data_key VARCHAR(1024) CHARACTER SET ascii COLLATE ascii_bin;
+ALTER TABLE object_chunks MODIFY data_key VARCHAR(1024) CHARACTER SET ascii COLLATE ascii_bin;
+ALTER TABLE uploads MODIFY data_key VARCHAR(1024) CHARACTER SET ascii COLLATE ascii_bin NOT NULL;
+ALTER TABLE prefix_schemas MODIFY prefix VARCHAR(1024) CHARACTER SET ascii COLLATE ascii_bin;
+
+SET FOREIGN_KEY_CHECKS = 1;
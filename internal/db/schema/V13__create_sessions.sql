@@ -0,0 +1,15 @@
+CREATE TABLE sessions (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    refresh_token_hash CHAR(64) NOT NULL,
+    expires_at BIGINT NOT NULL,
+    revoked BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE INDEX refresh_token_index (refresh_token_hash)
+);
+
+CREATE EVENT clean_expired_sessions
+ON SCHEDULE EVERY 1 DAY
+DO
+  DELETE FROM sessions
+  WHERE expires_at < UNIX_TIMESTAMP(NOW());
@@ -0,0 +1,3 @@
+ALTER TABLE sessions ADD COLUMN scopes JSON;
+
+ALTER TABLE api_keys ADD COLUMN scopes JSON;
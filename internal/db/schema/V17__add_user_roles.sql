@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN role VARCHAR(16) NOT NULL DEFAULT 'user',
+    ADD COLUMN suspended BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Administrators may provision more than the 2GB an INT holds.
+ALTER TABLE quotas
+    MODIFY provisioned BIGINT NOT NULL,
+    MODIFY utilised BIGINT NOT NULL;
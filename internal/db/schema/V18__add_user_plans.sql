@@ -0,0 +1,4 @@
+-- Existing users keep the capacity they registered with, on the plan whose
+-- limits match the ones that applied to them.
+ALTER TABLE users
+    ADD COLUMN plan VARCHAR(32) NOT NULL DEFAULT 'standard';
@@ -0,0 +1,5 @@
+ALTER TABLE uploads
+    ADD COLUMN expires_at BIGINT NOT NULL DEFAULT 0,
+    ADD INDEX expires_at_index (expires_at);
+
+UPDATE uploads SET expires_at = UNIX_TIMESTAMP(NOW()) + 86400;
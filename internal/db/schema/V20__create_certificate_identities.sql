@@ -0,0 +1,6 @@
+CREATE TABLE certificate_identities (
+    identity VARCHAR(255) PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at BIGINT NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+CREATE TABLE locks (
+    user_id INT,
+    lock_name VARCHAR(255),
+    owner VARCHAR(255),
+    fencing_token BIGINT NOT NULL DEFAULT 0,
+    ttl INT NOT NULL DEFAULT 0,
+    PRIMARY KEY(user_id, lock_name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,14 @@
+CREATE TABLE queue_messages (
+    id BIGINT AUTO_INCREMENT PRIMARY KEY,
+    user_id INT NOT NULL,
+    queue_name VARCHAR(255) NOT NULL,
+    body JSON,
+    size INT NOT NULL,
+    deliveries INT NOT NULL DEFAULT 0,
+    max_deliveries INT NOT NULL,
+    visible_at BIGINT NOT NULL DEFAULT 0,
+    receipt VARCHAR(64),
+    dead_lettered BOOLEAN NOT NULL DEFAULT FALSE,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX queue_index (user_id, queue_name, dead_lettered, visible_at, id)
+);
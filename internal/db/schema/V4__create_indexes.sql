@@ -0,0 +1,20 @@
+CREATE TABLE value_indexes (
+    user_id INT,
+    index_name VARCHAR(64),
+    json_path VARCHAR(255) NOT NULL,
+    PRIMARY KEY(user_id, index_name),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE index_entries (
+    user_id INT,
+    index_name VARCHAR(64),
+    data_key VARCHAR(32),
+    value_string VARCHAR(255),
+    value_number DOUBLE,
+    PRIMARY KEY(user_id, index_name, data_key),
+    FOREIGN KEY (user_id, index_name) REFERENCES value_indexes(user_id, index_name) ON DELETE CASCADE,
+    FOREIGN KEY (user_id, data_key) REFERENCES data_store(user_id, data_key) ON DELETE CASCADE ON UPDATE CASCADE,
+    INDEX string_index (user_id, index_name, value_string),
+    INDEX number_index (user_id, index_name, value_number)
+);
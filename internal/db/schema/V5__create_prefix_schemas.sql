@@ -0,0 +1,7 @@
+CREATE TABLE prefix_schemas (
+    user_id INT,
+    prefix VARCHAR(32),
+    schema_doc JSON NOT NULL,
+    PRIMARY KEY(user_id, prefix),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,6 @@
+ALTER TABLE data_store
+    ADD COLUMN data_blob MEDIUMBLOB,
+    ADD COLUMN content_type VARCHAR(255) NOT NULL DEFAULT 'application/json',
+    ADD COLUMN data_size INT NOT NULL DEFAULT 0;
+
+UPDATE data_store SET data_size = LENGTH(CAST(data_value AS CHAR));
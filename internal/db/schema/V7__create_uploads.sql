@@ -0,0 +1,28 @@
+CREATE TABLE uploads (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    data_key VARCHAR(32) NOT NULL,
+    content_type VARCHAR(255) NOT NULL,
+    ttl INT NOT NULL DEFAULT 0,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE upload_parts (
+    upload_id VARCHAR(64),
+    part_number INT,
+    data MEDIUMBLOB NOT NULL,
+    size INT NOT NULL,
+    PRIMARY KEY(upload_id, part_number),
+    FOREIGN KEY (upload_id) REFERENCES uploads(id) ON DELETE CASCADE
+);
+
+ALTER TABLE data_store ADD COLUMN chunked BOOLEAN NOT NULL DEFAULT FALSE;
+
+CREATE TABLE object_chunks (
+    user_id INT,
+    data_key VARCHAR(32),
+    chunk_offset BIGINT,
+    data MEDIUMBLOB NOT NULL,
+    PRIMARY KEY(user_id, data_key, chunk_offset),
+    FOREIGN KEY (user_id, data_key) REFERENCES data_store(user_id, data_key) ON DELETE CASCADE ON UPDATE CASCADE
+);
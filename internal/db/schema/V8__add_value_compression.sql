@@ -0,0 +1,9 @@
+ALTER TABLE data_store
+    ADD COLUMN is_json BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN encoding VARCHAR(16) NOT NULL DEFAULT 'identity',
+    ADD COLUMN charged_size INT NOT NULL DEFAULT 0;
+
+UPDATE data_store SET is_json = (data_value IS NOT NULL), charged_size = data_size;
+
+ALTER TABLE quotas
+    ADD COLUMN policy VARCHAR(16) NOT NULL DEFAULT 'logical';
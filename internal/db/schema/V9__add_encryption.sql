@@ -0,0 +1,17 @@
+CREATE TABLE tenant_keys (
+    user_id INT PRIMARY KEY,
+    master_key_id VARCHAR(64) NOT NULL,
+    wrapped_key VARBINARY(128) NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    INDEX master_key_index (master_key_id)
+);
+
+ALTER TABLE data_store ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE upload_parts ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE;
+
+ALTER TABLE object_chunks
+    ADD COLUMN encrypted BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN size INT NOT NULL DEFAULT 0;
+
+UPDATE object_chunks SET size = LENGTH(data);
@@ -0,0 +1,98 @@
+// Package jsonpath implements the small subset of JSON path used to address
+// fields inside stored values, e.g. `$.customer.email` or `$.items[0].sku`.
+package jsonpath
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidPath = errors.New("invalid json path, expected a path like $.field.nested or $.list[0]")
+
+// Segment is a single step of a path. Exactly one of Field or Index is used,
+// depending on IsIndex.
+type Segment struct {
+	Field   string
+	Index   int
+	IsIndex bool
+}
+
+type Path []Segment
+
+// Parse parses a path starting at the document root `$`.
+func Parse(path string) (Path, error) {
+	if !strings.HasPrefix(path, "$") {
+		return nil, ErrInvalidPath
+	}
+
+	var segments Path
+	rest := path[1:]
+	for rest != "" {
+		switch rest[0] {
+		case '.':
+			end := strings.IndexAny(rest[1:], ".[")
+			if end == -1 {
+				end = len(rest) - 1
+			}
+			field := rest[1 : end+1]
+			if field == "" {
+				return nil, ErrInvalidPath
+			}
+			segments = append(segments, Segment{Field: field})
+			rest = rest[end+1:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end == -1 {
+				return nil, ErrInvalidPath
+			}
+			idx, err := strconv.Atoi(rest[1:end])
+			if err != nil || idx < 0 {
+				return nil, ErrInvalidPath
+			}
+			segments = append(segments, Segment{Index: idx, IsIndex: true})
+			rest = rest[end+1:]
+		default:
+			return nil, ErrInvalidPath
+		}
+	}
+	return segments, nil
+}
+
+// Lookup resolves the path against a document decoded with encoding/json.
+// The boolean result is false when the path does not exist in the document.
+func (p Path) Lookup(doc any) (any, bool) {
+	current := doc
+	for _, seg := range p {
+		if seg.IsIndex {
+			list, ok := current.([]any)
+			if !ok || seg.Index >= len(list) {
+				return nil, false
+			}
+			current = list[seg.Index]
+			continue
+		}
+		obj, ok := current.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = obj[seg.Field]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+// String renders the path back to its textual form.
+func (p Path) String() string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, seg := range p {
+		if seg.IsIndex {
+			sb.WriteString("[" + strconv.Itoa(seg.Index) + "]")
+		} else {
+			sb.WriteString("." + seg.Field)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,364 @@
+// Package jsonschema validates decoded JSON values against the commonly used
+// subset of JSON Schema: type, enum, const, properties, required,
+// additionalProperties, items, minItems/maxItems, minLength/maxLength,
+// pattern, minimum/maximum and exclusiveMinimum/exclusiveMaximum. Other
+// keywords, such as allOf or $ref, are rejected rather than ignored, so that a
+// schema never looks stricter than it is. Annotations like title and
+// description are allowed.
+package jsonschema
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/santhoshm25/key-value-ds/internal/jsonpath"
+)
+
+// ValidationError describes the first violation found, with the JSON path of
+// the offending value.
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Path, e.Message)
+}
+
+type Schema struct {
+	rejectAll bool
+
+	types    []string
+	enum     []any
+	constVal any
+	hasConst bool
+
+	properties           map[string]*Schema
+	required             []string
+	additionalProperties *Schema
+
+	items    *Schema
+	minItems *int
+	maxItems *int
+
+	minLength *int
+	maxLength *int
+	pattern   *regexp.Regexp
+
+	minimum          *float64
+	maximum          *float64
+	exclusiveMinimum *float64
+	exclusiveMaximum *float64
+}
+
+var knownTypes = map[string]bool{
+	"null": true, "boolean": true, "object": true, "array": true,
+	"number": true, "integer": true, "string": true,
+}
+
+// knownKeywords are the keywords of the supported subset and the annotations,
+// which do not affect validation.
+var knownKeywords = map[string]bool{
+	"type": true, "enum": true, "const": true,
+	"properties": true, "required": true, "additionalProperties": true,
+	"items": true, "minItems": true, "maxItems": true,
+	"minLength": true, "maxLength": true, "pattern": true,
+	"minimum": true, "maximum": true, "exclusiveMinimum": true, "exclusiveMaximum": true,
+
+	"$schema": true, "$id": true, "$comment": true, "title": true, "description": true,
+	"default": true, "examples": true, "deprecated": true, "readOnly": true, "writeOnly": true,
+}
+
+// Compile builds a schema from its decoded JSON document.
+func Compile(doc any) (*Schema, error) {
+	switch doc := doc.(type) {
+	case bool:
+		return &Schema{rejectAll: !doc}, nil
+	case map[string]any:
+		return compileObject(doc)
+	}
+	return nil, fmt.Errorf("schema must be an object or a boolean")
+}
+
+func compileObject(doc map[string]any) (*Schema, error) {
+	for _, keyword := range sortedKeys(doc) {
+		if !knownKeywords[keyword] {
+			return nil, fmt.Errorf("unsupported keyword %q", keyword)
+		}
+	}
+
+	s := &Schema{}
+	var err error
+
+	switch t := doc["type"].(type) {
+	case nil:
+	case string:
+		s.types = []string{t}
+	case []any:
+		for _, item := range t {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("type must be a string or an array of strings")
+			}
+			s.types = append(s.types, name)
+		}
+	default:
+		return nil, fmt.Errorf("type must be a string or an array of strings")
+	}
+	for _, t := range s.types {
+		if !knownTypes[t] {
+			return nil, fmt.Errorf("unknown type %q", t)
+		}
+	}
+
+	if enum, ok := doc["enum"]; ok {
+		if s.enum, ok = enum.([]any); !ok {
+			return nil, fmt.Errorf("enum must be an array")
+		}
+	}
+	s.constVal, s.hasConst = doc["const"]
+
+	if props, ok := doc["properties"]; ok {
+		propsMap, ok := props.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("properties must be an object")
+		}
+		s.properties = make(map[string]*Schema, len(propsMap))
+		for name, propDoc := range propsMap {
+			if s.properties[name], err = Compile(propDoc); err != nil {
+				return nil, fmt.Errorf("properties.%s: %w", name, err)
+			}
+		}
+	}
+	if required, ok := doc["required"]; ok {
+		list, ok := required.([]any)
+		if !ok {
+			return nil, fmt.Errorf("required must be an array of strings")
+		}
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("required must be an array of strings")
+			}
+			s.required = append(s.required, name)
+		}
+	}
+	if additional, ok := doc["additionalProperties"]; ok {
+		if s.additionalProperties, err = Compile(additional); err != nil {
+			return nil, fmt.Errorf("additionalProperties: %w", err)
+		}
+	}
+	if items, ok := doc["items"]; ok {
+		if s.items, err = Compile(items); err != nil {
+			return nil, fmt.Errorf("items: %w", err)
+		}
+	}
+
+	for keyword, target := range map[string]**int{
+		"minItems": &s.minItems, "maxItems": &s.maxItems,
+		"minLength": &s.minLength, "maxLength": &s.maxLength,
+	} {
+		if *target, err = intKeyword(doc, keyword); err != nil {
+			return nil, err
+		}
+	}
+	for keyword, target := range map[string]**float64{
+		"minimum": &s.minimum, "maximum": &s.maximum,
+		"exclusiveMinimum": &s.exclusiveMinimum, "exclusiveMaximum": &s.exclusiveMaximum,
+	} {
+		if *target, err = numberKeyword(doc, keyword); err != nil {
+			return nil, err
+		}
+	}
+
+	if pattern, ok := doc["pattern"]; ok {
+		patternStr, ok := pattern.(string)
+		if !ok {
+			return nil, fmt.Errorf("pattern must be a string")
+		}
+		if s.pattern, err = regexp.Compile(patternStr); err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+	}
+	return s, nil
+}
+
+func sortedKeys(doc map[string]any) []string {
+	keys := make([]string, 0, len(doc))
+	for key := range doc {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func intKeyword(doc map[string]any, keyword string) (*int, error) {
+	value, ok := doc[keyword]
+	if !ok {
+		return nil, nil
+	}
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != math.Trunc(number) {
+		return nil, fmt.Errorf("%s must be a non-negative integer", keyword)
+	}
+	n := int(number)
+	return &n, nil
+}
+
+func numberKeyword(doc map[string]any, keyword string) (*float64, error) {
+	value, ok := doc[keyword]
+	if !ok {
+		return nil, nil
+	}
+	number, ok := value.(float64)
+	if !ok {
+		return nil, fmt.Errorf("%s must be a number", keyword)
+	}
+	return &number, nil
+}
+
+// Validate checks a value decoded with encoding/json against the schema.
+func (s *Schema) Validate(value any) error {
+	return s.validate(value, jsonpath.Path{})
+}
+
+func (s *Schema) validate(value any, path jsonpath.Path) error {
+	fail := func(format string, args ...any) error {
+		return &ValidationError{Path: path.String(), Message: fmt.Sprintf(format, args...)}
+	}
+
+	if s.rejectAll {
+		return fail("no value is allowed here")
+	}
+	if len(s.types) > 0 && !s.matchesType(value) {
+		return fail("expected type %v, got %s", typeList(s.types), typeOf(value))
+	}
+	if s.hasConst && !reflect.DeepEqual(value, s.constVal) {
+		return fail("value must be %v", s.constVal)
+	}
+	if s.enum != nil {
+		found := false
+		for _, allowed := range s.enum {
+			if reflect.DeepEqual(value, allowed) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fail("value must be one of %v", s.enum)
+		}
+	}
+
+	switch value := value.(type) {
+	case map[string]any:
+		for _, name := range s.required {
+			if _, ok := value[name]; !ok {
+				return fail("missing required property %q", name)
+			}
+		}
+		// Walk properties in a stable order so the reported violation is
+		// deterministic.
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			propPath := append(path[:len(path):len(path)], jsonpath.Segment{Field: name})
+			if propSchema, ok := s.properties[name]; ok {
+				if err := propSchema.validate(value[name], propPath); err != nil {
+					return err
+				}
+			} else if s.additionalProperties != nil {
+				if s.additionalProperties.rejectAll {
+					return fail("additional property %q is not allowed", name)
+				}
+				if err := s.additionalProperties.validate(value[name], propPath); err != nil {
+					return err
+				}
+			}
+		}
+	case []any:
+		if s.minItems != nil && len(value) < *s.minItems {
+			return fail("array must have at least %d items", *s.minItems)
+		}
+		if s.maxItems != nil && len(value) > *s.maxItems {
+			return fail("array must have at most %d items", *s.maxItems)
+		}
+		if s.items != nil {
+			for i, item := range value {
+				itemPath := append(path[:len(path):len(path)], jsonpath.Segment{Index: i, IsIndex: true})
+				if err := s.items.validate(item, itemPath); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := utf8.RuneCountInString(value)
+		if s.minLength != nil && length < *s.minLength {
+			return fail("string must be at least %d characters", *s.minLength)
+		}
+		if s.maxLength != nil && length > *s.maxLength {
+			return fail("string must be at most %d characters", *s.maxLength)
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			return fail("string must match pattern %q", s.pattern.String())
+		}
+	case float64:
+		if s.minimum != nil && value < *s.minimum {
+			return fail("number must be >= %v", *s.minimum)
+		}
+		if s.maximum != nil && value > *s.maximum {
+			return fail("number must be <= %v", *s.maximum)
+		}
+		if s.exclusiveMinimum != nil && value <= *s.exclusiveMinimum {
+			return fail("number must be > %v", *s.exclusiveMinimum)
+		}
+		if s.exclusiveMaximum != nil && value >= *s.exclusiveMaximum {
+			return fail("number must be < %v", *s.exclusiveMaximum)
+		}
+	}
+	return nil
+}
+
+func (s *Schema) matchesType(value any) bool {
+	actual := typeOf(value)
+	for _, t := range s.types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func typeOf(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		if value == math.Trunc(value) {
+			return "integer"
+		}
+		return "number"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func typeList(types []string) any {
+	if len(types) == 1 {
+		return types[0]
+	}
+	return types
+}
@@ -0,0 +1,154 @@
+// Package keyring holds the master keys that wrap the per-tenant data keys,
+// and the AES-GCM primitives used for both wrapping and value encryption.
+//
+// Master keys are configured as comma or newline separated "id:base64key"
+// entries, either inline in MASTER_KEYS or in the file named by
+// MASTER_KEY_FILE. New data keys are wrapped with the key named by
+// ACTIVE_MASTER_KEY_ID, which may be omitted when a single key is configured.
+// Keeping retired keys in the list lets data keys wrapped with them be read
+// and re-wrapped.
+package keyring
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const KeySize = 32 // AES-256
+
+var ErrUnknownKey = errors.New("unknown master key")
+
+type Keyring struct {
+	keys   map[string][]byte
+	active string
+}
+
+// Load reads the master keys from the environment. It returns a nil keyring
+// when no master key is configured.
+func Load() (*Keyring, error) {
+	entries := os.Getenv("MASTER_KEYS")
+	if path := os.Getenv("MASTER_KEY_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading master key file: %w", err)
+		}
+		entries += "\n" + string(data)
+	}
+	return Parse(entries, os.Getenv("ACTIVE_MASTER_KEY_ID"))
+}
+
+// Parse builds a keyring from "id:base64key" entries.
+func Parse(entries, active string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]byte), active: active}
+	for _, entry := range strings.FieldsFunc(entries, func(r rune) bool { return r == ',' || r == '\n' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		id, encoded, ok := strings.Cut(entry, ":")
+		if !ok || id == "" {
+			return nil, fmt.Errorf("master key entry must be id:base64key")
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != KeySize {
+			return nil, fmt.Errorf("master key %q must be %d base64 encoded bytes", id, KeySize)
+		}
+		if _, ok := k.keys[id]; ok {
+			return nil, fmt.Errorf("duplicate master key %q", id)
+		}
+		k.keys[id] = key
+	}
+
+	if len(k.keys) == 0 {
+		if active != "" {
+			return nil, fmt.Errorf("active master key %q is not configured", active)
+		}
+		return nil, nil
+	}
+	if k.active == "" {
+		if len(k.keys) > 1 {
+			return nil, fmt.Errorf("ACTIVE_MASTER_KEY_ID is required with several master keys")
+		}
+		for id := range k.keys {
+			k.active = id
+		}
+	}
+	if _, ok := k.keys[k.active]; !ok {
+		return nil, fmt.Errorf("active master key %q is not configured", k.active)
+	}
+	return k, nil
+}
+
+// ActiveID returns the id of the master key new data keys are wrapped with.
+func (k *Keyring) ActiveID() string {
+	return k.active
+}
+
+// NewDataKey generates a data key and wraps it with the active master key.
+func (k *Keyring) NewDataKey() (dataKey, wrapped []byte, err error) {
+	dataKey = make([]byte, KeySize)
+	if _, err = rand.Read(dataKey); err != nil {
+		return nil, nil, err
+	}
+	wrapped, err = k.Wrap(dataKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dataKey, wrapped, nil
+}
+
+// Wrap encrypts a data key with the active master key.
+func (k *Keyring) Wrap(dataKey []byte) ([]byte, error) {
+	return Seal(k.keys[k.active], dataKey, nil)
+}
+
+// Unwrap decrypts a data key wrapped with the master key of the given id.
+func (k *Keyring) Unwrap(id string, wrapped []byte) ([]byte, error) {
+	key, ok := k.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, id)
+	}
+	return Open(key, wrapped, nil)
+}
+
+// Seal encrypts plaintext with AES-GCM and returns the nonce followed by the
+// ciphertext. The additional data is authenticated but not encrypted, and the
+// same additional data must be passed to Open.
+func Seal(key, plaintext, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// Open reverses Seal.
+func Open(key, sealed, additionalData []byte) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, additionalData)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
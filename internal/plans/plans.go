@@ -0,0 +1,181 @@
+package plans
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/santhoshm25/key-value-ds/types"
+)
+
+// Tenants are on one of the plans, which decide their capacity and limits.
+// The built-in plans are replaced by the JSON array of plans in PLANS_FILE,
+// if set. New tenants join DEFAULT_PLAN, "standard" by default, and only
+// administrators move tenants to other plans.
+
+const (
+	defaultPlanName = "standard"
+
+	// maxValueLimit bounds the value size of plans. Values are stored in
+	// MEDIUMBLOB columns of 16MB, with room left for the encryption overhead.
+	maxValueLimit = 8388608 //8MB
+)
+
+var namePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+var builtinPlans = []*types.Plan{
+	{
+		Name:         "free",
+		Capacity:     104857600, //100MB
+		MaxValueSize: 16384,     //16KB
+		MaxBatchSize: 1048576,   //1MB
+		RateLimit:    10,
+		Burst:        20,
+	},
+	{
+		Name:         "standard",
+		Capacity:     1073741824, //1GB
+		MaxValueSize: 16384,      //16KB
+		MaxBatchSize: 4194304,    //4MB
+		RateLimit:    100,
+		Burst:        200,
+	},
+	{
+		Name:         "enterprise",
+		Capacity:     107374182400, //100GB
+		MaxValueSize: 1048576,      //1MB
+		MaxBatchSize: 16777216,     //16MB
+		RateLimit:    1000,
+		Burst:        2000,
+	},
+}
+
+var (
+	plans       map[string]*types.Plan
+	defaultPlan *types.Plan
+
+	// undefined holds the undefined plans that tenants were found on, which
+	// are warned about once.
+	undefined sync.Map
+)
+
+func init() {
+	plans, defaultPlan, _ = load(builtinPlans, defaultPlanName)
+}
+
+// Init reads the plans from the environment.
+func Init() {
+	configured := builtinPlans
+	if file := os.Getenv("PLANS_FILE"); file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Error("error reading plans", "error", err)
+			os.Exit(1)
+		}
+		configured = nil
+		if err := json.Unmarshal(data, &configured); err != nil {
+			slog.Error("error parsing plans", "file", file, "error", err)
+			os.Exit(1)
+		}
+	}
+	name := os.Getenv("DEFAULT_PLAN")
+	if name == "" {
+		name = defaultPlanName
+	}
+
+	var err error
+	plans, defaultPlan, err = load(configured, name)
+	if err != nil {
+		slog.Error("error loading plans", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("loaded plans", "plans", len(plans), "default", defaultPlan.Name)
+}
+
+func load(configured []*types.Plan, defaultName string) (map[string]*types.Plan, *types.Plan, error) {
+	loaded := make(map[string]*types.Plan, len(configured))
+	for _, plan := range configured {
+		if err := validate(plan); err != nil {
+			return nil, nil, err
+		}
+		if loaded[plan.Name] != nil {
+			return nil, nil, fmt.Errorf("plan %q is defined twice", plan.Name)
+		}
+		loaded[plan.Name] = plan
+	}
+	if len(loaded) == 0 {
+		return nil, nil, errors.New("no plans defined")
+	}
+	def, ok := loaded[defaultName]
+	if !ok {
+		return nil, nil, fmt.Errorf("default plan %q is not defined", defaultName)
+	}
+	return loaded, def, nil
+}
+
+func validate(plan *types.Plan) error {
+	if !namePattern.MatchString(plan.Name) {
+		return fmt.Errorf("plan name %q must be 1 to 32 lowercase letters, digits, '_' or '-'", plan.Name)
+	}
+	if plan.Capacity <= 0 || plan.MaxBatchSize <= 0 {
+		return fmt.Errorf("plan %q: capacity and max_batch_size must be positive", plan.Name)
+	}
+	if plan.MaxValueSize <= 0 || plan.MaxValueSize > maxValueLimit {
+		return fmt.Errorf("plan %q: max_value_size must be between 1 and %d", plan.Name, maxValueLimit)
+	}
+	if plan.RateLimit < 0 {
+		return fmt.Errorf("plan %q: rate_limit must not be negative", plan.Name)
+	}
+	if plan.RateLimit > 0 && plan.Burst < 1 {
+		return fmt.Errorf("plan %q: burst must be positive with a rate_limit", plan.Name)
+	}
+	return nil
+}
+
+// Default returns the plan new tenants join.
+func Default() *types.Plan {
+	return defaultPlan
+}
+
+// Lookup returns the plan with the given name.
+func Lookup(name string) (*types.Plan, bool) {
+	plan, ok := plans[name]
+	return plan, ok
+}
+
+// Get returns the plan of a tenant. Tenants on a plan that is no longer
+// defined get the limits of the default plan.
+func Get(name string) *types.Plan {
+	if plan, ok := plans[name]; ok {
+		return plan
+	}
+	if _, warned := undefined.LoadOrStore(name, true); !warned {
+		slog.Warn("tenants on an undefined plan, using the default plan", "plan", name, "default", defaultPlan.Name)
+	}
+	return defaultPlan
+}
+
+// List returns the plans by name.
+func List() []*types.Plan {
+	list := make([]*types.Plan, 0, len(plans))
+	for _, plan := range plans {
+		list = append(list, plan)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// MaxBodySize returns the largest batch or value size of the plans, which
+// bounds request bodies that are read before the tenant is known.
+func MaxBodySize() int64 {
+	var size int64
+	for _, plan := range plans {
+		size = max(size, plan.MaxBatchSize, plan.MaxValueSize)
+	}
+	return size
+}
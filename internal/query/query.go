@@ -0,0 +1,195 @@
+// Package query evaluates filter expressions over decoded JSON values.
+//
+// A filter is a tree of `and`/`or` nodes whose leaves compare the field at a
+// JSON path with a value:
+//
+//	{"and": [
+//	    {"path": "$.status", "op": "eq", "value": "active"},
+//	    {"or": [
+//	        {"path": "$.age", "op": "gte", "value": 18},
+//	        {"path": "$.guardian", "op": "exists"}
+//	    ]}
+//	]}
+package query
+
+import (
+	"cmp"
+	"fmt"
+	"reflect"
+
+	"github.com/santhoshm25/key-value-ds/internal/jsonpath"
+	"github.com/santhoshm25/key-value-ds/types"
+)
+
+const maxFilterNodes = 64
+
+const (
+	OpEq     = "eq"
+	OpNe     = "ne"
+	OpGt     = "gt"
+	OpGte    = "gte"
+	OpLt     = "lt"
+	OpLte    = "lte"
+	OpExists = "exists"
+)
+
+// Expr is a compiled filter, ready to be matched against values.
+type Expr struct {
+	and   []*Expr
+	or    []*Expr
+	path  jsonpath.Path
+	op    string
+	value any
+}
+
+// Compile validates a filter and parses its paths. A nil filter matches
+// every value.
+func Compile(filter *types.Filter) (*Expr, error) {
+	if filter == nil {
+		return nil, nil
+	}
+	nodes := 0
+	return compile(filter, &nodes)
+}
+
+func compile(filter *types.Filter, nodes *int) (*Expr, error) {
+	if filter == nil {
+		return nil, fmt.Errorf("filter nodes must not be null")
+	}
+	*nodes++
+	if *nodes > maxFilterNodes {
+		return nil, fmt.Errorf("filter is too large, at most %d nodes are allowed", maxFilterNodes)
+	}
+
+	isLeaf := filter.Path != "" || filter.Op != ""
+	kinds := 0
+	for _, set := range []bool{filter.And != nil, filter.Or != nil, isLeaf} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return nil, fmt.Errorf("each filter node must have exactly one of and, or, or a path with an op")
+	}
+
+	expr := &Expr{}
+	switch {
+	case filter.And != nil:
+		if len(filter.And) == 0 {
+			return nil, fmt.Errorf("and must have at least one filter")
+		}
+		for _, child := range filter.And {
+			childExpr, err := compile(child, nodes)
+			if err != nil {
+				return nil, err
+			}
+			expr.and = append(expr.and, childExpr)
+		}
+	case filter.Or != nil:
+		if len(filter.Or) == 0 {
+			return nil, fmt.Errorf("or must have at least one filter")
+		}
+		for _, child := range filter.Or {
+			childExpr, err := compile(child, nodes)
+			if err != nil {
+				return nil, err
+			}
+			expr.or = append(expr.or, childExpr)
+		}
+	default:
+		path, err := jsonpath.Parse(filter.Path)
+		if err != nil {
+			return nil, err
+		}
+		switch filter.Op {
+		case OpEq, OpNe, OpExists:
+		case OpGt, OpGte, OpLt, OpLte:
+			switch filter.Value.(type) {
+			case string, float64:
+			default:
+				return nil, fmt.Errorf("%s requires a string or number value", filter.Op)
+			}
+		default:
+			return nil, fmt.Errorf("unknown filter op %q", filter.Op)
+		}
+		expr.path, expr.op, expr.value = path, filter.Op, filter.Value
+	}
+	return expr, nil
+}
+
+// Match reports whether a decoded JSON document satisfies the expression.
+func (e *Expr) Match(doc any) bool {
+	if e == nil {
+		return true
+	}
+	switch {
+	case e.and != nil:
+		for _, child := range e.and {
+			if !child.Match(doc) {
+				return false
+			}
+		}
+		return true
+	case e.or != nil:
+		for _, child := range e.or {
+			if child.Match(doc) {
+				return true
+			}
+		}
+		return false
+	}
+
+	field, ok := e.path.Lookup(doc)
+	switch e.op {
+	case OpExists:
+		return ok
+	case OpEq:
+		return ok && reflect.DeepEqual(field, e.value)
+	case OpNe:
+		return !ok || !reflect.DeepEqual(field, e.value)
+	}
+	if !ok {
+		return false
+	}
+
+	order, ok := compare(field, e.value)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case OpGt:
+		return order > 0
+	case OpGte:
+		return order >= 0
+	case OpLt:
+		return order < 0
+	default:
+		return order <= 0
+	}
+}
+
+// compare orders two strings or two numbers. Values of different types are
+// not comparable.
+func compare(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case float64:
+		b, ok := b.(float64)
+		return cmp.Compare(a, b), ok
+	case string:
+		b, ok := b.(string)
+		return cmp.Compare(a, b), ok
+	}
+	return 0, false
+}
+
+// Project builds a document holding only the given fields, keyed by path.
+// Fields missing from the document are left out.
+func Project(doc any, fields []jsonpath.Path) map[string]any {
+	projected := make(map[string]any, len(fields))
+	for _, field := range fields {
+		if value, ok := field.Lookup(doc); ok {
+			projected[field.String()] = value
+		}
+	}
+	return projected
+}
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/auth"
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func GetProfileHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		profile, err := auth.Profile(db, userID)
+		sendHTTPResponse(profile, err, w)
+	}
+}
+
+// ChangePasswordHandler changes the password, which ends every session of the
+// user and revokes its API keys, so the client has to log in again.
+func ChangePasswordHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.PasswordChange{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = auth.ChangePassword(db, userID, req.CurrentPassword, req.NewPassword)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+// DeleteAccountHandler deletes the user and all of its data.
+func DeleteAccountHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.AccountDeletion{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = auth.DeleteAccount(db, userID, req.Password)
+		sendHTTPResponse(nil, err, w)
+	}
+}
@@ -0,0 +1,292 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/auth"
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	defaultTenantListLimit = 100
+	maxTenantListLimit     = 1000
+)
+
+// AdminHandler is AuthHandler for routes only administrators may use.
+func AdminHandler(db db.Database, h httprouter.Handle) func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	return AuthHandler(db, func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if err := auth.RequireAdmin(db, userID); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		h(w, r, ps)
+	})
+}
+
+// ListTenantsHandler lists tenants in id order. The "after" query parameter
+// continues from the last id of the previous page.
+func ListTenantsHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		after, limit := 0, defaultTenantListLimit
+		var err error
+		if value := r.URL.Query().Get("after"); value != "" {
+			if after, err = strconv.Atoi(value); err != nil || after < 0 {
+				sendHTTPResponse(nil, utils.ErrBadRequest("invalid after"), w)
+				return
+			}
+		}
+		if value := r.URL.Query().Get("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit <= 0 || limit > maxTenantListLimit {
+				sendHTTPResponse(nil, utils.ErrBadRequest("limit must be between 1 and %d", maxTenantListLimit), w)
+				return
+			}
+		}
+
+		tenants, err := db.ListTenants(after, limit)
+		sendHTTPResponse(tenants, err, w)
+	}
+}
+
+func GetTenantHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+// SetTenantCapacityHandler changes the provisioned capacity of a tenant.
+func SetTenantCapacityHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.CapacityUpdate{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if req.Provisioned <= 0 {
+			sendHTTPResponse(nil, utils.ErrBadRequest("provisioned must be positive"), w)
+			return
+		}
+
+		if err := db.SetProvisionedCapacity(tenantID, req.Provisioned); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+// SetTenantPlanHandler moves a tenant to another plan. The tenant is
+// provisioned the capacity of the plan.
+func SetTenantPlanHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.PlanUpdate{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := auth.SetPlan(db, tenantID, req.Plan); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+// SetTenantPolicyHandler selects whether a tenant's values are charged by
+// their logical size or by their compressed size.
+func SetTenantPolicyHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.PolicyUpdate{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if req.Policy != types.LogicalQuotaPolicy && req.Policy != types.PhysicalQuotaPolicy {
+			sendHTTPResponse(nil, utils.ErrBadRequest("policy must be %q or %q", types.LogicalQuotaPolicy, types.PhysicalQuotaPolicy), w)
+			return
+		}
+
+		if err := db.SetQuotaPolicy(tenantID, req.Policy); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+func SetTenantRoleHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		adminID, tenantID, err := extractAdminAndTenant(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.RoleUpdate{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := auth.SetRole(db, adminID, tenantID, req.Role); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+func ListTenantCertificatesHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if _, err := db.GetTenant(tenantID); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		bindings, err := db.ListCertificates(tenantID)
+		sendHTTPResponse(bindings, err, w)
+	}
+}
+
+// BindTenantCertificateHandler lets client certificates with an identity
+// authenticate as a tenant.
+func BindTenantCertificateHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		binding := &types.CertificateBinding{}
+		err = utils.ExtractRequestBody(r.Body, binding)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := auth.BindCertificate(db, tenantID, binding); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		writeResponse(http.StatusCreated, binding, w)
+	}
+}
+
+func UnbindTenantCertificateHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		tenantID, err := extractTenantID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		binding := &types.CertificateBinding{}
+		err = utils.ExtractRequestBody(r.Body, binding)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = auth.UnbindCertificate(db, tenantID, binding.Identity)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+// SuspendTenantHandler suspends a tenant when suspended is set and reinstates
+// it otherwise.
+func SuspendTenantHandler(db db.Database, suspended bool) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		adminID, tenantID, err := extractAdminAndTenant(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := auth.SuspendTenant(db, adminID, tenantID, suspended); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		tenant, err := db.GetTenant(tenantID)
+		sendHTTPResponse(tenant, err, w)
+	}
+}
+
+// DeleteTenantHandler deletes a tenant and all of its data.
+func DeleteTenantHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		adminID, tenantID, err := extractAdminAndTenant(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = auth.DeleteTenant(db, adminID, tenantID)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func extractTenantID(ps httprouter.Params) (int, error) {
+	id, err := strconv.Atoi(ps.ByName("id"))
+	if err != nil || id <= 0 {
+		return 0, utils.ErrBadRequest("invalid tenant id")
+	}
+	return id, nil
+}
+
+func extractAdminAndTenant(ps httprouter.Params) (int, int, error) {
+	adminID, err := extractUserId(ps)
+	if err != nil {
+		return 0, 0, err
+	}
+	tenantID, err := extractTenantID(ps)
+	return adminID, tenantID, err
+}
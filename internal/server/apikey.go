@@ -0,0 +1,80 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/auth"
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const maxAPIKeyNameSize = 255
+
+// CreateAPIKeyHandler creates an API key. The response is the only time the
+// key itself is returned.
+func CreateAPIKeyHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.APIKey{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if req.Name == "" || len(req.Name) > maxAPIKeyNameSize {
+			sendHTTPResponse(nil, utils.ErrBadRequest("name must be between 1 and %d characters", maxAPIKeyNameSize), w)
+			return
+		}
+		if err := validateTTL(req.ExpiresAt); err != nil {
+			sendHTTPResponse(nil, utils.ErrBadRequest("invalid expires_at"), w)
+			return
+		}
+
+		if err := auth.ValidateScopes(req.Scopes); err != nil {
+			sendHTTPResponse(nil, utils.ErrBadRequest(err.Error()), w)
+			return
+		}
+
+		key, err := auth.CreateAPIKey(db, userID, req.Name, req.ExpiresAt, req.Scopes)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		writeResponse(http.StatusCreated, key, w)
+	}
+}
+
+func ListAPIKeysHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		keys, err := db.ListAPIKeys(userID)
+		sendHTTPResponse(keys, err, w)
+	}
+}
+
+func DeleteAPIKeyHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = auth.RevokeAPIKey(db, userID, ps.ByName("id"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
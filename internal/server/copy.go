@@ -0,0 +1,73 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func CopyObjectHandler(db db.Database) httprouter.Handle {
+	return moveObjectHandler(db, db.CopyObject, types.ReadPermission)
+}
+
+func RenameObjectHandler(db db.Database) httprouter.Handle {
+	return moveObjectHandler(db, db.RenameObject, types.ReadPermission, types.DeletePermission)
+}
+
+// moveObjectHandler handles a copy or rename, which requires the given
+// permissions on the source and write access to the destination.
+func moveObjectHandler(db db.Database, move func(int, *types.MoveRequest) error, sourcePermissions ...string) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		req := &types.MoveRequest{}
+		err = utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := validateMoveRequest(req); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		for _, permission := range sourcePermissions {
+			if err := authorize(r, permission, req.Source); err != nil {
+				sendHTTPResponse(nil, err, w)
+				return
+			}
+		}
+		if err := authorize(r, types.WritePermission, req.Destination); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = move(userID, req)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func validateMoveRequest(req *types.MoveRequest) error {
+	if req.Source == "" || req.Destination == "" {
+		return utils.ErrBadRequest("source and destination are required")
+	}
+	if err := validateKey(req.Source); err != nil {
+		return err
+	}
+	if err := validateKey(req.Destination); err != nil {
+		return err
+	}
+	if req.Source == req.Destination {
+		return utils.ErrBadRequest("source and destination must differ")
+	}
+	return nil
+}
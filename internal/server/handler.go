@@ -1,16 +1,23 @@
 package server
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"log/slog"
+	"math"
 	"net/http"
+	"os"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/santhoshm25/key-value-ds/internal/auth"
 	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
 	"github.com/santhoshm25/key-value-ds/types"
 	"github.com/santhoshm25/key-value-ds/utils"
 
@@ -18,11 +25,34 @@ import (
 )
 
 const (
-	maxKeySize    = 32
-	maxBatchLimit = 4194304 //4MB
-
+	defaultMaxKeySize = 1024
+	maxKeyColumnSize  = 1024 // size of the data_key columns
+	ttlParam          = "ttl"
+	maxTags           = 16
+	maxTagKeySize     = 64
+	maxTagValueSize   = 256
 )
 
+// maxKeySize is the longest key accepted, in bytes. It is configured with
+// MAX_KEY_SIZE.
+var maxKeySize = defaultMaxKeySize
+
+// Keys are path-like strings of printable ASCII that are safe to use in a URL
+// path without escaping.
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9!_.*'()/:@=+,~-]+$`)
+
+// Init reads the server configuration from the environment.
+func Init() {
+	if size := os.Getenv("MAX_KEY_SIZE"); size != "" {
+		var err error
+		maxKeySize, err = strconv.Atoi(size)
+		if err != nil || maxKeySize <= 0 || maxKeySize > maxKeyColumnSize {
+			slog.Error("invalid max key size", "value", size, "max", maxKeyColumnSize)
+			os.Exit(1)
+		}
+	}
+}
+
 func RegisterHandler(db db.Database) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		user := &types.User{}
@@ -55,23 +85,134 @@ func LoginHandler(db db.Database) httprouter.Handle {
 	}
 }
 
-func AuthHandler(db db.Database, h httprouter.Handle) func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+func RefreshHandler(db db.Database) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
-		token := r.Header.Get("Authorization")
-		if token == "" {
-			sendHTTPResponse(nil, utils.ErrUnAuthorized("authorization token not found"), w)
+		req := &types.RefreshRequest{}
+
+		err := utils.ExtractRequestBody(r.Body, req)
+		if err != nil {
+			err = utils.ErrBadRequest(utils.InvalidBodyErr)
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		body, err := auth.Refresh(db, req.RefreshToken)
+		sendHTTPResponse(body, err, w)
+	}
+}
+
+// JWKSHandler publishes the public keys tokens are verified with.
+func JWKSHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		sendHTTPResponse(auth.PublicKeys(), nil, w)
+	}
+}
+
+// LogoutHandler revokes the session of the request's access token, along with
+// its refresh token.
+func LogoutHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
 			return
 		}
 
-		claims, err := auth.ValidateToken(token)
+		err = auth.Logout(db, userID, ps.ByName("session_id"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+// AuthHandler authenticates the request before passing it to h. Credentials
+// restricted by scopes are refused, since h does not check them.
+func AuthHandler(db db.Database, h httprouter.Handle) func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	return authHandler(db, h, false)
+}
+
+// ScopedAuthHandler is AuthHandler for handlers that check the scopes of the
+// request's credentials with authorize.
+func ScopedAuthHandler(db db.Database, h httprouter.Handle) func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	return authHandler(db, h, true)
+}
+
+func authHandler(db db.Database, h httprouter.Handle, scoped bool) func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		var claims *auth.Claims
+		var err error
+		if token := r.Header.Get("Authorization"); auth.IsSigned(token) {
+			claims, err = authenticateSignature(db, r, token)
+		} else if token != "" {
+			claims, err = auth.Authenticate(db, token)
+		} else if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+			// Only certificates signed by the configured client CA are verified.
+			claims, err = auth.AuthenticateCertificate(db, r.TLS.VerifiedChains[0][0])
+		} else {
+			err = utils.ErrUnAuthorized("authorization token not found")
+		}
 		if err != nil {
 			sendHTTPResponse(nil, utils.ErrUnAuthorized(err.Error()), w)
 			return
 		}
+		// Credentials outlive suspensions and deletions of their user.
+		if err := auth.CheckAccount(db, int(claims.UserID)); err != nil {
+			if apiErr, ok := err.(*utils.Error); ok && apiErr.Code == http.StatusNotFound {
+				err = utils.ErrUnAuthorized(err.Error())
+			}
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		plan, err := auth.AccountPlan(db, int(claims.UserID))
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if ok, retryAfter := limiter.allow(int(claims.UserID), plan); !ok {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			sendHTTPResponse(nil, utils.ErrTooManyRequests(utils.RateLimitedErr), w)
+			return
+		}
+		if !scoped && !claims.Unrestricted() {
+			sendHTTPResponse(nil, utils.ErrForbidden("credentials restricted by scopes cannot use this route"), w)
+			return
+		}
 		ps = append(ps, httprouter.Param{Key: "user_id", Value: fmt.Sprintf("%d", claims.UserID)})
+		ps = append(ps, httprouter.Param{Key: "session_id", Value: claims.Id})
+
+		h(w, r.WithContext(auth.NewContext(r.Context(), claims)), ps)
+	}
+}
+
+// authenticateSignature verifies a signed request. The signature covers the
+// body, which is read here and put back for the handler. The tenant is not
+// known yet, so the body is bounded by the largest sizes the plans allow.
+func authenticateSignature(db db.Database, r *http.Request, authorization string) (*auth.Claims, error) {
+	var body []byte
+	if r.Body != nil {
+		maxBodySize := plans.MaxBodySize()
+		var err error
+		body, err = io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+		r.Body.Close()
+		if err != nil {
+			slog.Error("error reading request body", "error", err)
+			return nil, utils.ErrBadRequest(utils.InvalidBodyErr)
+		}
+		if int64(len(body)) > maxBodySize {
+			return nil, utils.ErrBadRequest("request body exceeds %d bytes", maxBodySize)
+		}
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return auth.AuthenticateSignature(db, authorization, r.Method, r.RequestURI, body)
+}
 
-		h(w, r, ps)
+// authorize checks that the credentials of the request grant permission on
+// key. A key prefix stands for every key that starts with it.
+func authorize(r *http.Request, permission, key string) error {
+	claims, ok := auth.FromContext(r.Context())
+	if !ok || !claims.Allows(permission, key) {
+		return utils.ErrForbidden("credentials do not grant %s access to %q", permission, key)
 	}
+	return nil
 }
 
 func CreateObjectHandler(db db.Database) httprouter.Handle {
@@ -94,6 +235,11 @@ func CreateObjectHandler(db db.Database) httprouter.Handle {
 			return
 		}
 
+		if err := authorize(r, types.WritePermission, object.Key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
 		err = db.CreateObject(userId, object)
 		sendHTTPResponse(nil, err, w)
 	}
@@ -106,7 +252,11 @@ func GetObjectHandler(db db.Database) httprouter.Handle {
 			sendHTTPResponse(nil, err, w)
 			return
 		}
-		key := ps.ByName("key")
+		key := objectKey(ps)
+		if err := authorize(r, types.ReadPermission, key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
 
 		object, err := db.GetObject(userID, key)
 		if err != nil {
@@ -120,10 +270,125 @@ func GetObjectHandler(db db.Database) httprouter.Handle {
 			go db.DeleteObject(userID, key)
 		}
 
+		if err == nil && (object.Data != nil || object.Chunked) {
+			sendBinaryObject(db, userID, object, r, w)
+			return
+		}
 		sendHTTPResponse(object, err, w)
 	}
 }
 
+// HeadObjectHandler reports an object's metadata in response headers, without
+// reading its value.
+func HeadObjectHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		key := objectKey(ps)
+		if err := authorize(r, types.ReadPermission, key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		meta, err := getLiveMetadata(db, userID, key)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		w.Header().Set("Content-Type", meta.ContentType)
+		w.Header().Set("ETag", fmt.Sprintf(`"%d"`, meta.Version))
+		w.Header().Set("X-Object-Size", strconv.FormatInt(meta.Size, 10))
+		w.Header().Set("X-Object-Version", strconv.FormatInt(meta.Version, 10))
+		w.Header().Set("X-Object-TTL", strconv.FormatInt(meta.TTL, 10))
+		w.Header().Set("X-Object-Created-At", strconv.FormatInt(meta.CreatedAt, 10))
+		w.Header().Set("X-Object-Updated-At", strconv.FormatInt(meta.UpdatedAt, 10))
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func GetObjectMetadataHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		key := objectKey(ps)
+		if err := authorize(r, types.ReadPermission, key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		meta, err := getLiveMetadata(db, userID, key)
+		sendHTTPResponse(meta, err, w)
+	}
+}
+
+func getLiveMetadata(db db.Database, userID int, key string) (*types.ObjectMetadata, error) {
+	meta, err := db.GetObjectMetadata(userID, key)
+	if err != nil {
+		return nil, err
+	}
+	if err = validateTTL(meta.TTL); err != nil {
+		go db.DeleteObject(userID, key)
+		return nil, utils.ErrNotFound(utils.ObjectNotFoundErr)
+	}
+	return meta, nil
+}
+
+// PutBinaryObjectHandler stores the raw request body under the key. The
+// request Content-Type is kept and returned on GET, and the TTL is taken from
+// the ttl query parameter.
+func PutBinaryObjectHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		object := &types.Object{Key: objectKey(ps), ContentType: r.Header.Get("Content-Type")}
+		if object.ContentType == "" {
+			sendHTTPResponse(nil, utils.ErrBadRequest("content type is required"), w)
+			return
+		}
+		if ttl := r.URL.Query().Get(ttlParam); ttl != "" {
+			if object.TTL, err = strconv.ParseInt(ttl, 10, 64); err != nil {
+				sendHTTPResponse(nil, utils.ErrBadRequest("invalid ttl"), w)
+				return
+			}
+		}
+		if err := validateObject(object); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if err := authorize(r, types.WritePermission, object.Key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		plan, err := auth.AccountPlan(db, userID)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		object.Data, err = utils.ReadRawBody(r.Body, plan.MaxValueSize)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.PutBinaryObject(userID, object)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
 func DeleteObjectHandler(db db.Database) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
 		userID, err := extractUserId(ps)
@@ -131,7 +396,12 @@ func DeleteObjectHandler(db db.Database) httprouter.Handle {
 			sendHTTPResponse(nil, err, w)
 			return
 		}
-		key := ps.ByName("key")
+		key := objectKey(ps)
+		if err := authorize(r, types.DeletePermission, key); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
 		err = db.DeleteObject(userID, key)
 		sendHTTPResponse(nil, err, w)
 	}
@@ -152,11 +422,53 @@ func BatchCreateObjectHandler(db db.Database) httprouter.Handle {
 			return
 		}
 
+		for _, object := range objects {
+			if err := authorize(r, types.WritePermission, object.Key); err != nil {
+				sendHTTPResponse(nil, err, w)
+				return
+			}
+		}
+
 		err = db.BatchCreateObject(userId, objects)
 		sendHTTPResponse(nil, err, w)
 	}
 }
 
+func CompareAndSwapObjectHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userId, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		casReq := &types.CASRequest{}
+		err = utils.ExtractRequestBody(r.Body, casReq)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		object := &types.Object{Key: casReq.Key, Value: casReq.Value, TTL: casReq.TTL}
+		if err := validateObject(object); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		// The outcome of a swap reveals whether the stored value matched, so
+		// it requires read access as well.
+		for _, permission := range []string{types.ReadPermission, types.WritePermission} {
+			if err := authorize(r, permission, object.Key); err != nil {
+				sendHTTPResponse(nil, err, w)
+				return
+			}
+		}
+
+		err = db.CompareAndSwapObject(userId, object, casReq.Expected)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
 func sendHTTPResponse(body any, err error, w http.ResponseWriter) {
 	var statusCode int
 	var resp any
@@ -207,12 +519,50 @@ func validateObject(obj *types.Object) error {
 	if err != nil {
 		return utils.ErrBadRequest(err.Error())
 	}
-	if len(obj.Key) > maxKeySize {
-		return utils.ErrBadRequest("key size exceeded, must be within %d characters", maxKeySize)
+	if err := validateKey(obj.Key); err != nil {
+		return err
+	}
+	if len(obj.Tags) > maxTags {
+		return utils.ErrBadRequest("too many tags, at most %d are allowed", maxTags)
+	}
+	for name, value := range obj.Tags {
+		if name == "" || len(name) > maxTagKeySize {
+			return utils.ErrBadRequest("tag names must be between 1 and %d characters", maxTagKeySize)
+		}
+		if len(value) > maxTagValueSize {
+			return utils.ErrBadRequest("tag %q exceeds %d characters", name, maxTagValueSize)
+		}
+	}
+	return nil
+}
+
+// validateKey checks the length and characters of a key. "/" separates the
+// segments of hierarchical keys, but keys may not start with it or contain "."
+// or ".." segments, which clients and proxies normalise away in URLs.
+func validateKey(key string) error {
+	if len(key) > maxKeySize {
+		return utils.ErrBadRequest("key size exceeded, must be within %d bytes", maxKeySize)
+	}
+	if !keyPattern.MatchString(key) {
+		return utils.ErrBadRequest("key must be non-empty and only contain letters, digits and !_.*'()/:@=+,~-")
+	}
+	if strings.HasPrefix(key, "/") {
+		return utils.ErrBadRequest("key must not start with /")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "." || segment == ".." {
+			return utils.ErrBadRequest("key must not contain . or .. segments")
+		}
 	}
 	return nil
 }
 
+// objectKey returns the key of an object route. Keys are matched by a
+// catch-all parameter, so they may contain "/".
+func objectKey(ps httprouter.Params) string {
+	return strings.TrimPrefix(ps.ByName("key"), "/")
+}
+
 func validateTTL(ttl int64) error {
 	if ttl != 0 && ttl < time.Now().Unix() {
 		return errors.New("invalid ttl")
@@ -220,35 +570,31 @@ func validateTTL(ttl int64) error {
 	return nil
 }
 
-func ValidateAndPrepareBatchRequest(userID int, objs []*types.Object, availableBytes int64) (int64, []string, []any, error) {
+// ValidateAndPrepareBatchRequest validates the objects of a batch and replaces
+// each Value with its JSON encoding. The encoded values may add up to at most
+// maxBatchSize bytes.
+func ValidateAndPrepareBatchRequest(objs []*types.Object, maxBatchSize int64) error {
 	batchSize := int64(0)
-	queryPlaceholders := make([]string, len(objs))
-	queryArgs := make([]any, 0)
 
-	for idx, obj := range objs {
+	for _, obj := range objs {
 		err := validateObject(obj)
 		if err != nil {
-			return 0, []string{}, []any{}, err
+			return err
 		}
 
 		valBytes, err := json.Marshal(obj.Value)
 		if err != nil {
 			slog.Error("error marshalling value", "error", err)
-			return 0, []string{}, []any{}, utils.ErrBadRequest("error marshalling value: %s", err.Error())
+			return utils.ErrBadRequest("error marshalling value: %s", err.Error())
 		}
 
 		obj.Value = valBytes
 		batchSize += int64(len(valBytes))
 		slog.Info("batchSize", "value", batchSize)
-		queryPlaceholders[idx] = "(?, ?, ?, ?)"
-		queryArgs = append(queryArgs, userID, obj.Key, obj.Value, obj.TTL)
 	}
-	if batchSize > availableBytes {
-		return 0, []string{}, []any{}, utils.ErrForbidden(utils.QuotaExceededErr)
-	}
-	if batchSize > maxBatchLimit {
-		return 0, []string{}, []any{}, utils.ErrBadRequest("batch size limit exceeded, max limit is %d", maxBatchLimit)
+	if batchSize > maxBatchSize {
+		return utils.ErrBadRequest("batch size limit exceeded, max limit is %d", maxBatchSize)
 	}
 
-	return batchSize, queryPlaceholders, queryArgs, nil
+	return nil
 }
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/jsonpath"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	maxIndexNameSize  = 64
+	defaultQueryLimit = 100
+	maxQueryLimit     = 1000
+)
+
+func CreateIndexHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		index := &types.Index{}
+		err = utils.ExtractRequestBody(r.Body, index)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if index.Name == "" || len(index.Name) > maxIndexNameSize {
+			sendHTTPResponse(nil, utils.ErrBadRequest("index name is required and must be within %d characters", maxIndexNameSize), w)
+			return
+		}
+		if _, err := jsonpath.Parse(index.Path); err != nil {
+			sendHTTPResponse(nil, utils.ErrBadRequest(err.Error()), w)
+			return
+		}
+
+		err = db.CreateIndex(userID, index)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func ListIndexesHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		indexes, err := db.ListIndexes(userID)
+		sendHTTPResponse(indexes, err, w)
+	}
+}
+
+func DeleteIndexHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.DeleteIndex(userID, ps.ByName("name"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func QueryIndexHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		query := &types.IndexQuery{}
+		err = utils.ExtractRequestBody(r.Body, query)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if err := validateIndexQuery(query); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		// Index entries span the whole keyspace.
+		if err := authorize(r, types.ReadPermission, ""); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		objs, err := db.QueryIndex(userID, ps.ByName("name"), query)
+		sendHTTPResponse(objs, err, w)
+	}
+}
+
+// validateIndexQuery makes sure a query is either an equality match or a
+// range, and that all of its bounds are of the same type (string or number).
+func validateIndexQuery(query *types.IndexQuery) error {
+	if query.Limit == 0 {
+		query.Limit = defaultQueryLimit
+	}
+	if query.Limit < 0 || query.Limit > maxQueryLimit {
+		return utils.ErrBadRequest("limit must be between 1 and %d", maxQueryLimit)
+	}
+
+	rangeBounds := []any{query.Gt, query.Gte, query.Lt, query.Lte}
+	var kind string
+	for _, bound := range append([]any{query.Eq}, rangeBounds...) {
+		var boundKind string
+		switch bound.(type) {
+		case nil:
+			continue
+		case string:
+			boundKind = "string"
+		case float64:
+			boundKind = "number"
+		default:
+			return utils.ErrBadRequest("query values must be strings or numbers")
+		}
+		if kind != "" && kind != boundKind {
+			return utils.ErrBadRequest("query values must all be of the same type")
+		}
+		kind = boundKind
+	}
+
+	if kind == "" {
+		return utils.ErrBadRequest("query must have an eq condition or a range")
+	}
+	if query.Eq != nil {
+		for _, bound := range rangeBounds {
+			if bound != nil {
+				return utils.ErrBadRequest("eq cannot be combined with a range")
+			}
+		}
+	}
+	return nil
+}
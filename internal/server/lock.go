@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	maxLockNameSize  = 255
+	maxLockOwnerSize = 255
+	maxLockLease     = 86400 // 1 day
+)
+
+func AcquireLockHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, name, lockReq, err := extractLockRequest(r, ps, true)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		lock, err := db.AcquireLock(userID, name, lockReq.Owner, leaseExpiry(lockReq.Lease))
+		sendHTTPResponse(lock, err, w)
+	}
+}
+
+func RenewLockHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, name, lockReq, err := extractLockRequest(r, ps, true)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		lock, err := db.RenewLock(userID, name, lockReq.Owner, leaseExpiry(lockReq.Lease))
+		sendHTTPResponse(lock, err, w)
+	}
+}
+
+func ReleaseLockHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, name, lockReq, err := extractLockRequest(r, ps, false)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.ReleaseLock(userID, name, lockReq.Owner)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func GetLockHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		lock, err := db.GetLock(userID, ps.ByName("name"))
+		sendHTTPResponse(lock, err, w)
+	}
+}
+
+func extractLockRequest(r *http.Request, ps httprouter.Params, withLease bool) (int, string, *types.LockRequest, error) {
+	userID, err := extractUserId(ps)
+	if err != nil {
+		return 0, "", nil, err
+	}
+
+	name := ps.ByName("name")
+	if len(name) > maxLockNameSize {
+		return 0, "", nil, utils.ErrBadRequest("lock name size exceeded, must be within %d characters", maxLockNameSize)
+	}
+
+	lockReq := &types.LockRequest{}
+	if err := utils.ExtractRequestBody(r.Body, lockReq); err != nil {
+		return 0, "", nil, err
+	}
+	if lockReq.Owner == "" || len(lockReq.Owner) > maxLockOwnerSize {
+		return 0, "", nil, utils.ErrBadRequest("owner is required and must be within %d characters", maxLockOwnerSize)
+	}
+	if withLease && (lockReq.Lease <= 0 || lockReq.Lease > maxLockLease) {
+		return 0, "", nil, utils.ErrBadRequest("lease must be between 1 and %d seconds", maxLockLease)
+	}
+	return userID, name, lockReq, nil
+}
+
+func leaseExpiry(lease int64) int64 {
+	return time.Now().Add(time.Duration(lease) * time.Second).Unix()
+}
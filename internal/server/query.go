@@ -0,0 +1,109 @@
+package server
+
+import (
+	"encoding/base64"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/jsonpath"
+	"github.com/santhoshm25/key-value-ds/internal/query"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	scanBatchSize   = 200
+	maxScanPerQuery = 10000
+)
+
+// QueryObjectsHandler scans the tenant's objects in key order and returns the
+// ones matching the filter. Every call scans at most maxScanPerQuery objects;
+// when more remain, the response carries a cursor to continue from.
+func QueryObjectsHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		queryReq := &types.QueryRequest{}
+		err = utils.ExtractRequestBody(r.Body, queryReq)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := authorize(r, types.ReadPermission, queryReq.Prefix); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		expr, fields, after, err := prepareQuery(queryReq)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		resp := &types.QueryResponse{Objects: make([]*types.Object, 0)}
+		scanned, exhausted := 0, false
+		for !exhausted && len(resp.Objects) < queryReq.Limit && scanned < maxScanPerQuery {
+			objs, err := db.ScanObjects(userID, queryReq.Prefix, queryReq.Tags, after, scanBatchSize)
+			if err != nil {
+				sendHTTPResponse(nil, err, w)
+				return
+			}
+			exhausted = len(objs) < scanBatchSize
+
+			for i, obj := range objs {
+				scanned++
+				after = obj.Key
+				if !expr.Match(obj.Value) {
+					continue
+				}
+				if len(fields) > 0 {
+					obj.Value = query.Project(obj.Value, fields)
+				}
+				resp.Objects = append(resp.Objects, obj)
+				if len(resp.Objects) == queryReq.Limit {
+					exhausted = exhausted && i == len(objs)-1
+					break
+				}
+			}
+		}
+		if !exhausted {
+			resp.Cursor = base64.RawURLEncoding.EncodeToString([]byte(after))
+		}
+
+		sendHTTPResponse(resp, nil, w)
+	}
+}
+
+func prepareQuery(queryReq *types.QueryRequest) (*query.Expr, []jsonpath.Path, string, error) {
+	if queryReq.Limit == 0 {
+		queryReq.Limit = defaultQueryLimit
+	}
+	if queryReq.Limit < 0 || queryReq.Limit > maxQueryLimit {
+		return nil, nil, "", utils.ErrBadRequest("limit must be between 1 and %d", maxQueryLimit)
+	}
+
+	expr, err := query.Compile(queryReq.Filter)
+	if err != nil {
+		return nil, nil, "", utils.ErrBadRequest("invalid filter: %s", err.Error())
+	}
+
+	fields := make([]jsonpath.Path, len(queryReq.Fields))
+	for i, field := range queryReq.Fields {
+		if fields[i], err = jsonpath.Parse(field); err != nil {
+			return nil, nil, "", utils.ErrBadRequest("invalid field %q: %s", field, err.Error())
+		}
+	}
+
+	after, err := base64.RawURLEncoding.DecodeString(queryReq.Cursor)
+	if err != nil {
+		return nil, nil, "", utils.ErrBadRequest("invalid cursor")
+	}
+	return expr, fields, string(after), nil
+}
@@ -0,0 +1,161 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	maxQueueNameSize         = 255
+	defaultMaxDeliveries     = 5
+	maxMaxDeliveries         = 100
+	defaultVisibilityTimeout = 30    // 30 seconds
+	maxVisibilityTimeout     = 43200 // 12 hours
+	deadLetterListLimit      = 100
+)
+
+func EnqueueHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, queue, err := extractQueue(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		msg := &types.QueueMessage{}
+		err = utils.ExtractRequestBody(r.Body, msg)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if msg.MaxDeliveries == 0 {
+			msg.MaxDeliveries = defaultMaxDeliveries
+		}
+		if msg.MaxDeliveries < 0 || msg.MaxDeliveries > maxMaxDeliveries {
+			sendHTTPResponse(nil, utils.ErrBadRequest("max_deliveries must be between 1 and %d", maxMaxDeliveries), w)
+			return
+		}
+
+		err = db.Enqueue(userID, queue, msg)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		writeResponse(http.StatusCreated, msg, w)
+	}
+}
+
+func DequeueHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, queue, err := extractQueue(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		dequeueReq := &types.DequeueRequest{}
+		err = utils.ExtractRequestBody(r.Body, dequeueReq)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if dequeueReq.VisibilityTimeout == 0 {
+			dequeueReq.VisibilityTimeout = defaultVisibilityTimeout
+		}
+		if dequeueReq.VisibilityTimeout < 0 || dequeueReq.VisibilityTimeout > maxVisibilityTimeout {
+			sendHTTPResponse(nil, utils.ErrBadRequest("visibility_timeout must be between 1 and %d seconds", maxVisibilityTimeout), w)
+			return
+		}
+
+		visibleAt := time.Now().Add(time.Duration(dequeueReq.VisibilityTimeout) * time.Second).Unix()
+		msg, err := db.Dequeue(userID, queue, visibleAt)
+		if err != nil || msg == nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		sendHTTPResponse(msg, nil, w)
+	}
+}
+
+func AckMessageHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, queue, err := extractQueue(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		id, err := extractMessageID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		ackReq := &types.AckRequest{}
+		err = utils.ExtractRequestBody(r.Body, ackReq)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.AckMessage(userID, queue, id, ackReq.Receipt)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func ListDeadLettersHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, queue, err := extractQueue(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		msgs, err := db.ListDeadLetters(userID, queue, deadLetterListLimit)
+		sendHTTPResponse(msgs, err, w)
+	}
+}
+
+func DeleteDeadLetterHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, queue, err := extractQueue(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		id, err := extractMessageID(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.DeleteDeadLetter(userID, queue, id)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func extractQueue(ps httprouter.Params) (int, string, error) {
+	userID, err := extractUserId(ps)
+	if err != nil {
+		return 0, "", err
+	}
+	queue := ps.ByName("name")
+	if len(queue) > maxQueueNameSize {
+		return 0, "", utils.ErrBadRequest("queue name size exceeded, must be within %d characters", maxQueueNameSize)
+	}
+	return userID, queue, nil
+}
+
+func extractMessageID(ps httprouter.Params) (int64, error) {
+	id, err := strconv.ParseInt(ps.ByName("id"), 10, 64)
+	if err != nil {
+		return 0, utils.ErrBadRequest("invalid message ID")
+	}
+	return id, nil
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
+)
+
+func GetQuotaHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		quota, err := db.GetQuota(userID)
+		sendHTTPResponse(quota, err, w)
+	}
+}
+
+// ListPlansHandler lists the plans tenants can be moved to. The plan of the
+// tenant is part of its quota.
+func ListPlansHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		sendHTTPResponse(plans.List(), nil, w)
+	}
+}
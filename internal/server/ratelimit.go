@@ -0,0 +1,70 @@
+package server
+
+import (
+	"sync"
+	"time"
+
+	"github.com/santhoshm25/key-value-ds/types"
+)
+
+// Requests of a tenant are limited by a token bucket that holds up to the
+// burst of its plan and refills at the plan's rate. Buckets are kept per
+// instance, so each instance allows the full rate.
+
+// pruneBuckets is how many buckets are kept before full ones are dropped.
+// A full bucket is the same as no bucket.
+const pruneBuckets = 10000
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[int]*bucket
+}
+
+var limiter = &rateLimiter{buckets: make(map[int]*bucket)}
+
+// allow takes a token from the tenant's bucket. When the bucket is empty, it
+// returns how long until the next token.
+func (l *rateLimiter) allow(userID int, plan *types.Plan) (bool, time.Duration) {
+	if plan.RateLimit <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	burst := float64(plan.Burst)
+	b, ok := l.buckets[userID]
+	if !ok {
+		if len(l.buckets) >= pruneBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: burst, updatedAt: now}
+		l.buckets[userID] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.updatedAt).Seconds()*plan.RateLimit)
+	b.updatedAt = now
+	if b.tokens < 1 {
+		return false, seconds((1 - b.tokens) / plan.RateLimit)
+	}
+	b.tokens--
+	b.fullAt = now.Add(seconds((burst - b.tokens) / plan.RateLimit))
+	return true, 0
+}
+
+func (l *rateLimiter) prune(now time.Time) {
+	for userID, b := range l.buckets {
+		if now.After(b.fullAt) {
+			delete(l.buckets, userID)
+		}
+	}
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,66 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/internal/jsonschema"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+func PutSchemaHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		schema := &types.Schema{}
+		err = utils.ExtractRequestBody(r.Body, schema)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		if len(schema.Prefix) > maxKeySize {
+			sendHTTPResponse(nil, utils.ErrBadRequest("prefix size exceeded, must be within %d bytes", maxKeySize), w)
+			return
+		}
+		if _, err := jsonschema.Compile(schema.Schema); err != nil {
+			sendHTTPResponse(nil, utils.ErrBadRequest("invalid schema: %s", err.Error()), w)
+			return
+		}
+
+		err = db.PutSchema(userID, schema)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func ListSchemasHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		schemas, err := db.ListSchemas(userID)
+		sendHTTPResponse(schemas, err, w)
+	}
+}
+
+func DeleteSchemaHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.DeleteSchema(userID, r.URL.Query().Get("prefix"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
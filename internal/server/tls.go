@@ -0,0 +1,98 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval bounds how often the certificate files are checked for
+// changes, so that certificates renewed on disk are picked up without a
+// restart.
+const certReloadInterval = 1 * time.Minute
+
+// TLSConfig returns the TLS configuration the server is served with, or nil
+// to serve plain HTTP. TLS is enabled by TLS_CERT_FILE and TLS_KEY_FILE. With
+// TLS_CLIENT_CA_FILE, client certificates signed by that CA are verified and
+// authenticate requests without an Authorization header. Clients may still
+// connect without a certificate and authenticate with a token.
+func TLSConfig() (*tls.Config, error) {
+	certFile, keyFile := os.Getenv("TLS_CERT_FILE"), os.Getenv("TLS_KEY_FILE")
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("TLS_CERT_FILE and TLS_KEY_FILE must be set together")
+	}
+	cert := &certReloader{certFile: certFile, keyFile: keyFile}
+	if err := cert.load(); err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: cert.get,
+	}
+	if caFile := os.Getenv("TLS_CLIENT_CA_FILE"); caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", caFile)
+		}
+		config.ClientCAs = pool
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+	return config, nil
+}
+
+type certReloader struct {
+	certFile, keyFile string
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	modTime   time.Time
+	checkedAt time.Time
+}
+
+func (c *certReloader) load() error {
+	info, err := os.Stat(c.certFile)
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(c.certFile, c.keyFile)
+	if err != nil {
+		return err
+	}
+	c.cert, c.modTime = &cert, info.ModTime()
+	return nil
+}
+
+// get returns the server certificate, reloading it when the certificate file
+// changed. A certificate that fails to load is logged and the previous one
+// kept.
+func (c *certReloader) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if time.Since(c.checkedAt) < certReloadInterval {
+		return c.cert, nil
+	}
+	c.checkedAt = time.Now()
+	if info, err := os.Stat(c.certFile); err != nil || info.ModTime().Equal(c.modTime) {
+		return c.cert, nil
+	}
+	if err := c.load(); err != nil {
+		slog.Error("error reloading TLS certificate", "error", err)
+		return c.cert, nil
+	}
+	slog.Info("reloaded TLS certificate", "file", c.certFile)
+	return c.cert, nil
+}
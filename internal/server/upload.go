@@ -0,0 +1,183 @@
+package server
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/santhoshm25/key-value-ds/internal/db"
+	"github.com/santhoshm25/key-value-ds/types"
+	"github.com/santhoshm25/key-value-ds/utils"
+)
+
+const (
+	maxPartSize   = 1048576 //1MB
+	maxPartNumber = 10000
+)
+
+func CreateUploadHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		upload := &types.Upload{}
+		err = utils.ExtractRequestBody(r.Body, upload)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if upload.ContentType == "" {
+			sendHTTPResponse(nil, utils.ErrBadRequest("content type is required"), w)
+			return
+		}
+		if err := validateObject(&types.Object{Key: upload.Key, TTL: upload.TTL}); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		if err := db.CreateUpload(userID, upload); err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+		writeResponse(http.StatusCreated, upload, w)
+	}
+}
+
+func UploadPartHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		partNumber, err := strconv.Atoi(ps.ByName("number"))
+		if err != nil || partNumber < 1 || partNumber > maxPartNumber {
+			sendHTTPResponse(nil, utils.ErrBadRequest("part number must be between 1 and %d", maxPartNumber), w)
+			return
+		}
+
+		data, err := utils.ReadRawBody(r.Body, maxPartSize)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.UploadPart(userID, ps.ByName("id"), partNumber, data)
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func CompleteUploadHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.CompleteUpload(userID, ps.ByName("id"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+func AbortUploadHandler(db db.Database) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, ps httprouter.Params) {
+		userID, err := extractUserId(ps)
+		if err != nil {
+			sendHTTPResponse(nil, err, w)
+			return
+		}
+
+		err = db.AbortUpload(userID, ps.ByName("id"))
+		sendHTTPResponse(nil, err, w)
+	}
+}
+
+// sendBinaryObject writes the bytes of a binary object, honouring a single
+// range in the Range header. Chunked objects are streamed from the database
+// so they are never held in memory whole.
+func sendBinaryObject(db db.Database, userID int, object *types.Object, r *http.Request, w http.ResponseWriter) {
+	size := object.Size
+	if !object.Chunked {
+		size = int64(len(object.Data))
+	}
+
+	start, end, partial, err := parseRange(r.Header.Get("Range"), size)
+	if err != nil {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes */%d", size))
+		sendHTTPResponse(nil, utils.NewError(http.StatusRequestedRangeNotSatisfiable, err.Error()), w)
+		return
+	}
+
+	w.Header().Set("Content-Type", object.ContentType)
+	w.Header().Set("X-Object-TTL", strconv.FormatInt(object.TTL, 10))
+	w.Header().Set("X-Object-Created-At", strconv.FormatInt(object.CreatedAt, 10))
+	w.Header().Set("X-Object-Updated-At", strconv.FormatInt(object.UpdatedAt, 10))
+	w.Header().Set("Accept-Ranges", "bytes")
+	w.Header().Set("Content-Length", strconv.FormatInt(end-start+1, 10))
+	if partial {
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+		w.WriteHeader(http.StatusPartialContent)
+	}
+
+	if !object.Chunked {
+		w.Write(object.Data[start : end+1])
+		return
+	}
+	// The status and headers are already sent, so a failure partway through
+	// can only cut the body short of its Content-Length.
+	if err := db.StreamObject(userID, object.Key, start, end, w); err != nil {
+		slog.Error("error streaming object", "key", object.Key, "error", err)
+	}
+}
+
+// parseRange parses a Range header holding a single "bytes=a-b", "bytes=a-"
+// or "bytes=-n" range. An empty header selects the whole object.
+func parseRange(header string, size int64) (int64, int64, bool, error) {
+	if header == "" {
+		return 0, size - 1, false, nil
+	}
+
+	spec, ok := strings.CutPrefix(header, "bytes=")
+	if !ok || strings.Contains(spec, ",") {
+		return 0, 0, false, fmt.Errorf("only a single byte range is supported")
+	}
+	first, last, ok := strings.Cut(spec, "-")
+	if !ok {
+		return 0, 0, false, fmt.Errorf("invalid range")
+	}
+
+	var start, end int64
+	var err error
+	if first == "" {
+		suffix, err := strconv.ParseInt(last, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false, fmt.Errorf("invalid range")
+		}
+		start, end = max(size-suffix, 0), size-1
+	} else {
+		if start, err = strconv.ParseInt(first, 10, 64); err != nil || start < 0 {
+			return 0, 0, false, fmt.Errorf("invalid range")
+		}
+		end = size - 1
+		if last != "" {
+			if end, err = strconv.ParseInt(last, 10, 64); err != nil || end < start {
+				return 0, 0, false, fmt.Errorf("invalid range")
+			}
+			end = min(end, size-1)
+		}
+	}
+	if start >= size {
+		return 0, 0, false, fmt.Errorf("range not satisfiable")
+	}
+	return start, end, true, nil
+}
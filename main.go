@@ -4,10 +4,13 @@ import (
 	"log"
 	"log/slog"
 	"net/http"
+	"os"
 
 	"github.com/julienschmidt/httprouter"
 
+	"github.com/santhoshm25/key-value-ds/internal/auth"
 	"github.com/santhoshm25/key-value-ds/internal/db/mysql"
+	"github.com/santhoshm25/key-value-ds/internal/plans"
 	"github.com/santhoshm25/key-value-ds/internal/server"
 	"github.com/santhoshm25/key-value-ds/utils"
 )
@@ -18,20 +21,101 @@ const (
 
 func main() {
 	utils.InitEnv()
+	plans.Init()
+	auth.Init()
+	server.Init()
 
 	msDB := mysql.NewDB()
 	msDB.Init()
+	if len(os.Args) > 1 && os.Args[1] == "promote-admin" {
+		promoteAdmins(msDB, os.Args[2:])
+		return
+	}
 
 	router := httprouter.New()
+	router.GET("/.well-known/jwks.json", server.JWKSHandler())
 	router.POST("/api/auth/register", server.RegisterHandler(msDB))
 	router.POST("/api/auth/login", server.LoginHandler(msDB))
-	router.POST("/api/object", server.AuthHandler(msDB, server.CreateObjectHandler(msDB)))
-	router.GET("/api/object/:key", server.AuthHandler(msDB, server.GetObjectHandler(msDB)))
-	router.DELETE("/api/object/:key", server.AuthHandler(msDB, server.DeleteObjectHandler(msDB)))
-	router.POST("/api/batch/object", server.AuthHandler(msDB, server.BatchCreateObjectHandler(msDB)))
+	router.POST("/api/auth/refresh", server.RefreshHandler(msDB))
+	router.POST("/api/auth/logout", server.ScopedAuthHandler(msDB, server.LogoutHandler(msDB)))
+	router.GET("/api/account", server.AuthHandler(msDB, server.GetProfileHandler(msDB)))
+	router.PUT("/api/account/password", server.AuthHandler(msDB, server.ChangePasswordHandler(msDB)))
+	router.DELETE("/api/account", server.AuthHandler(msDB, server.DeleteAccountHandler(msDB)))
+	router.POST("/api/keys", server.AuthHandler(msDB, server.CreateAPIKeyHandler(msDB)))
+	router.GET("/api/keys", server.AuthHandler(msDB, server.ListAPIKeysHandler(msDB)))
+	router.DELETE("/api/keys/:id", server.AuthHandler(msDB, server.DeleteAPIKeyHandler(msDB)))
+	router.POST("/api/object", server.ScopedAuthHandler(msDB, server.CreateObjectHandler(msDB)))
+	router.POST("/api/object/cas", server.ScopedAuthHandler(msDB, server.CompareAndSwapObjectHandler(msDB)))
+	router.POST("/api/object/copy", server.ScopedAuthHandler(msDB, server.CopyObjectHandler(msDB)))
+	router.POST("/api/object/rename", server.ScopedAuthHandler(msDB, server.RenameObjectHandler(msDB)))
+	router.GET("/api/object/*key", server.ScopedAuthHandler(msDB, server.GetObjectHandler(msDB)))
+	router.HEAD("/api/object/*key", server.ScopedAuthHandler(msDB, server.HeadObjectHandler(msDB)))
+	router.GET("/api/metadata/*key", server.ScopedAuthHandler(msDB, server.GetObjectMetadataHandler(msDB)))
+	router.PUT("/api/object/*key", server.ScopedAuthHandler(msDB, server.PutBinaryObjectHandler(msDB)))
+	router.DELETE("/api/object/*key", server.ScopedAuthHandler(msDB, server.DeleteObjectHandler(msDB)))
+	router.POST("/api/batch/object", server.ScopedAuthHandler(msDB, server.BatchCreateObjectHandler(msDB)))
+	router.POST("/api/lock/:name", server.AuthHandler(msDB, server.AcquireLockHandler(msDB)))
+	router.PUT("/api/lock/:name", server.AuthHandler(msDB, server.RenewLockHandler(msDB)))
+	router.DELETE("/api/lock/:name", server.AuthHandler(msDB, server.ReleaseLockHandler(msDB)))
+	router.GET("/api/lock/:name", server.AuthHandler(msDB, server.GetLockHandler(msDB)))
+	router.POST("/api/queue/:name/message", server.AuthHandler(msDB, server.EnqueueHandler(msDB)))
+	router.POST("/api/queue/:name/dequeue", server.AuthHandler(msDB, server.DequeueHandler(msDB)))
+	router.DELETE("/api/queue/:name/message/:id", server.AuthHandler(msDB, server.AckMessageHandler(msDB)))
+	router.GET("/api/queue/:name/dead", server.AuthHandler(msDB, server.ListDeadLettersHandler(msDB)))
+	router.DELETE("/api/queue/:name/dead/:id", server.AuthHandler(msDB, server.DeleteDeadLetterHandler(msDB)))
+	router.POST("/api/index", server.AuthHandler(msDB, server.CreateIndexHandler(msDB)))
+	router.GET("/api/index", server.AuthHandler(msDB, server.ListIndexesHandler(msDB)))
+	router.DELETE("/api/index/:name", server.AuthHandler(msDB, server.DeleteIndexHandler(msDB)))
+	router.POST("/api/index/:name/query", server.ScopedAuthHandler(msDB, server.QueryIndexHandler(msDB)))
+	router.POST("/api/query", server.ScopedAuthHandler(msDB, server.QueryObjectsHandler(msDB)))
+	router.PUT("/api/schema", server.AuthHandler(msDB, server.PutSchemaHandler(msDB)))
+	router.GET("/api/schema", server.AuthHandler(msDB, server.ListSchemasHandler(msDB)))
+	router.DELETE("/api/schema", server.AuthHandler(msDB, server.DeleteSchemaHandler(msDB)))
+	router.POST("/api/upload", server.AuthHandler(msDB, server.CreateUploadHandler(msDB)))
+	router.PUT("/api/upload/:id/part/:number", server.AuthHandler(msDB, server.UploadPartHandler(msDB)))
+	router.POST("/api/upload/:id/complete", server.AuthHandler(msDB, server.CompleteUploadHandler(msDB)))
+	router.DELETE("/api/upload/:id", server.AuthHandler(msDB, server.AbortUploadHandler(msDB)))
+	router.GET("/api/plans", server.AuthHandler(msDB, server.ListPlansHandler()))
+	router.GET("/api/quota", server.AuthHandler(msDB, server.GetQuotaHandler(msDB)))
+	router.GET("/api/admin/tenants", server.AdminHandler(msDB, server.ListTenantsHandler(msDB)))
+	router.GET("/api/admin/tenants/:id", server.AdminHandler(msDB, server.GetTenantHandler(msDB)))
+	router.DELETE("/api/admin/tenants/:id", server.AdminHandler(msDB, server.DeleteTenantHandler(msDB)))
+	router.PUT("/api/admin/tenants/:id/capacity", server.AdminHandler(msDB, server.SetTenantCapacityHandler(msDB)))
+	router.PUT("/api/admin/tenants/:id/plan", server.AdminHandler(msDB, server.SetTenantPlanHandler(msDB)))
+	router.GET("/api/admin/tenants/:id/certificates", server.AdminHandler(msDB, server.ListTenantCertificatesHandler(msDB)))
+	router.POST("/api/admin/tenants/:id/certificates", server.AdminHandler(msDB, server.BindTenantCertificateHandler(msDB)))
+	router.DELETE("/api/admin/tenants/:id/certificates", server.AdminHandler(msDB, server.UnbindTenantCertificateHandler(msDB)))
+	router.PUT("/api/admin/tenants/:id/policy", server.AdminHandler(msDB, server.SetTenantPolicyHandler(msDB)))
+	router.PUT("/api/admin/tenants/:id/role", server.AdminHandler(msDB, server.SetTenantRoleHandler(msDB)))
+	router.POST("/api/admin/tenants/:id/suspend", server.AdminHandler(msDB, server.SuspendTenantHandler(msDB, true)))
+	router.POST("/api/admin/tenants/:id/unsuspend", server.AdminHandler(msDB, server.SuspendTenantHandler(msDB, false)))
 
+	tlsConfig, err := server.TLSConfig()
+	if err != nil {
+		slog.Error("error loading TLS configuration", "error", err)
+		os.Exit(1)
+	}
+	srv := &http.Server{Addr: port, Handler: router, TLSConfig: tlsConfig}
+	if tlsConfig != nil {
+		slog.Info("Starting TLS server on", "port", port, "client_certificates", tlsConfig.ClientCAs != nil)
+		log.Fatal(srv.ListenAndServeTLS("", ""))
+	}
 	slog.Info("Starting server on", "port", port)
-	log.Fatal(http.ListenAndServe(port, router))
+	log.Fatal(srv.ListenAndServe())
 
 	defer log.Fatal(msDB.Db.Close())
 }
+
+// promoteAdmins gives the named users, who must have registered, the
+// administrator role, which bootstraps the first administrators.
+func promoteAdmins(msDB *mysql.MysqlDB, names []string) {
+	if len(names) == 0 {
+		slog.Error("usage: datastore promote-admin NAME...")
+		os.Exit(2)
+	}
+	if err := auth.PromoteAdmins(msDB, names); err != nil {
+		slog.Error("error promoting administrators", "error", err)
+		os.Exit(1)
+	}
+	slog.Info("promoted administrators", "users", names)
+}
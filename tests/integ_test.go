@@ -2,10 +2,24 @@ package integ_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
 	"strconv"
 	"strings"
 	"testing"
@@ -14,6 +28,12 @@ import (
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 
+	"github.com/golang-jwt/jwt"
+
+	"github.com/santhoshm25/key-value-ds/client"
+	"github.com/santhoshm25/key-value-ds/internal/auth"
+	"github.com/santhoshm25/key-value-ds/internal/db/mysql"
+	"github.com/santhoshm25/key-value-ds/internal/keyring"
 	"github.com/santhoshm25/key-value-ds/types"
 )
 
@@ -31,11 +51,10 @@ var _ = Describe("Integration Tests", func() {
 
 	// Helper Functions
 
-	registerUser := func(name, password string, provisionedCapacity int64) *http.Response {
+	registerUser := func(name, password string) *http.Response {
 		user := types.User{
-			Name:                name,
-			Password:            password,
-			ProvisionedCapacity: provisionedCapacity,
+			Name:     name,
+			Password: password,
 		}
 		body, err := json.Marshal(user)
 		Expect(err).To(BeNil())
@@ -124,6 +143,69 @@ var _ = Describe("Integration Tests", func() {
 		return resp
 	}
 
+	// doRequest sends an authorized JSON request and returns the raw response.
+	doRequest := func(method, path, token string, payload any) *http.Response {
+		var body io.Reader
+		if payload != nil {
+			data, err := json.Marshal(payload)
+			Expect(err).To(BeNil())
+			body = bytes.NewBuffer(data)
+		}
+		req, err := http.NewRequest(method, fmt.Sprintf("%s%s", baseURL, path), body)
+		Expect(err).To(BeNil())
+		req.Header.Set("Content-Type", contentType)
+		req.Header.Set("Authorization", token)
+		resp, err := http.DefaultClient.Do(req)
+		Expect(err).To(BeNil())
+		return resp
+	}
+
+	// registerAndLogin registers a fresh user on the default plan and returns
+	// its token.
+	registerAndLogin := func(name, password string) string {
+		resp := registerUser(name, password)
+		Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		token, loginResp := loginUser(name, password)
+		Expect(loginResp.StatusCode).To(Equal(http.StatusOK))
+		return token
+	}
+
+	getProfile := func(token string) types.Profile {
+		resp := doRequest(http.MethodGet, "/api/account", token, nil)
+		Expect(resp.StatusCode).To(Equal(http.StatusOK))
+		defer resp.Body.Close()
+		var p types.Profile
+		Expect(json.NewDecoder(resp.Body).Decode(&p)).To(Succeed())
+		return p
+	}
+
+	// openDatabase connects to the database of the server. Specs that need it
+	// are skipped unless DATABASE_URL is set.
+	openDatabase := func() *sql.DB {
+		dsn := os.Getenv("DATABASE_URL")
+		if dsn == "" {
+			Skip("DATABASE_URL is not set")
+		}
+		db, err := sql.Open("mysql", dsn)
+		Expect(err).To(BeNil())
+		DeferCleanup(db.Close)
+		return db
+	}
+
+	// loginAdmin returns a token of the administrator, registering it and
+	// promoting it like the promote-admin command on first use. The promotion
+	// happens before the account's first request, so the server has no role
+	// of it cached.
+	loginAdmin := func() string {
+		registerUser("adminUser", "adminPass").Body.Close()
+		db := openDatabase()
+		Expect(auth.PromoteAdmins(&mysql.MysqlDB{Db: db}, []string{"adminUser"})).To(Succeed())
+		token, loginResp := loginUser("adminUser", "adminPass")
+		Expect(loginResp.StatusCode).To(Equal(http.StatusOK))
+		Expect(getProfile(token).Role).To(Equal(types.AdminRole))
+		return token
+	}
+
 	cleanup := func(token, key string) {
 		req, err := http.NewRequest(http.MethodDelete,
 			fmt.Sprintf("%s/api/object/%s", baseURL, key),
@@ -138,7 +220,7 @@ var _ = Describe("Integration Tests", func() {
 
 	cleanupTestData := func() {
 		// Create a test user for cleanup
-		resp := registerUser("cleanupUser", "cleanupPass", 1073741824)
+		resp := registerUser("cleanupUser", "cleanupPass")
 		if resp.StatusCode != http.StatusCreated {
 			return
 		}
@@ -179,10 +261,9 @@ var _ = Describe("Integration Tests", func() {
 	})
 
 	Describe("User Registration and Login", func() {
-		const defaultCapacity = 1073741824 // 1GB
 		Context("When a new user registers", func() {
 			It("should register and log in successfully", func() {
-				resp := registerUser("normalUser", "normalPass", defaultCapacity)
+				resp := registerUser("normalUser", "normalPass")
 				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
 
 				token, loginResp := loginUser("normalUser", "normalPass")
@@ -194,11 +275,11 @@ var _ = Describe("Integration Tests", func() {
 		Context("When a duplicate user registers", func() {
 			It("should fail with a duplicate user error", func() {
 				// First registration should succeed.
-				resp1 := registerUser("dupUser", "dupPass", defaultCapacity)
+				resp1 := registerUser("dupUser", "dupPass")
 				Expect(resp1.StatusCode).To(Equal(http.StatusCreated))
 
 				// Second registration (with the same credentials) should fail.
-				resp2 := registerUser("dupUser", "dupPass", defaultCapacity)
+				resp2 := registerUser("dupUser", "dupPass")
 				// Expect 400 Bad Request for duplicate registration.
 				Expect(resp2.StatusCode).To(Equal(http.StatusBadRequest))
 				bodyBytes, err := io.ReadAll(resp2.Body)
@@ -211,7 +292,7 @@ var _ = Describe("Integration Tests", func() {
 		Context("When logging in with invalid credentials", func() {
 			It("should fail to log in", func() {
 				// Register a valid user.
-				resp := registerUser("invalidLoginUser", "correctPass", defaultCapacity)
+				resp := registerUser("invalidLoginUser", "correctPass")
 				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
 
 				// Attempt to log in with an incorrect password.
@@ -227,7 +308,7 @@ var _ = Describe("Integration Tests", func() {
 		It("should register and log in successfully", func() {
 			user := "objectUser"
 			pass := "objectPass"
-			resp := registerUser(user, pass, getTTL())
+			resp := registerUser(user, pass)
 			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
 			tkn, _ := loginUser(user, pass)
 			token = tkn
@@ -269,10 +350,33 @@ var _ = Describe("Integration Tests", func() {
 			})
 		})
 
+		Context("Hierarchical keys", func() {
+			It("should read and delete keys containing slashes", func() {
+				key := "orders/2026/10/16/" + strings.Repeat("f", 200)
+				resp := createObject(token, key, map[string]any{"id": 1}, getTTL())
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				resp.Body.Close()
+
+				obj, respGet := getObject(token, key)
+				Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+				respGet.Body.Close()
+				Expect(obj.Key).To(Equal(key))
+
+				resp = doRequest(http.MethodHead, "/api/object/"+key, token, nil)
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				resp.Body.Close()
+
+				Expect(deleteObject(token, key).StatusCode).To(Equal(http.StatusNoContent))
+				_, respGet = getObject(token, key)
+				Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+				respGet.Body.Close()
+			})
+		})
+
 		Context("Exceeding allowed limits", func() {
 			It("should fail to create an object with a key that exceeds the allowed length", func() {
-				// Generate a key longer than 32 characters.
-				longKey := strings.Repeat("a", 33)
+				// Generate a key longer than the default limit of 1024 bytes.
+				longKey := strings.Repeat("a", 1025)
 				resp := createObject(token, longKey, "value", getTTL())
 				// Expect the operation not to succeed.
 				Expect(resp.StatusCode).ToNot(Equal(http.StatusCreated))
@@ -282,6 +386,14 @@ var _ = Describe("Integration Tests", func() {
 				Expect(string(bodyBytes)).To(ContainSubstring("key"))
 			})
 
+			It("should reject keys with disallowed characters or segments", func() {
+				for _, key := range []string{"with space", "/leading", "a/../b", "query?"} {
+					resp := createObject(token, key, "value", getTTL())
+					Expect(resp.StatusCode).To(Equal(http.StatusBadRequest), key)
+					resp.Body.Close()
+				}
+			})
+
 			It("should fail to create an object with a value that exceeds the allowed size", func() {
 				// Generate a string longer than 16KB (16384 bytes) for the value.
 				longValue := strings.Repeat("v", 16385)
@@ -297,10 +409,14 @@ var _ = Describe("Integration Tests", func() {
 		Describe("Quota Enforcement", func() {
 			Context("When a user's provisioned capacity is lower", func() {
 				It("should fail to create an object that exceeds the quota", func() {
-					// Register a user with a very low capacity (e.g., 100 bytes).
-					resp := registerUser("quotaUser", "quotaPass", 100)
-					Expect(resp.StatusCode).To(Equal(http.StatusCreated))
-					token, _ := loginUser("quotaUser", "quotaPass")
+					// Only administrators can lower the capacity of a user,
+					// here to 100 bytes.
+					adminToken := loginAdmin()
+					token := registerAndLogin("quotaUser", "quotaPass")
+					resp := doRequest(http.MethodPut, fmt.Sprintf("/api/admin/tenants/%d/capacity", getProfile(token).ID),
+						adminToken, types.CapacityUpdate{Provisioned: 100})
+					Expect(resp.StatusCode).To(Equal(http.StatusOK))
+					resp.Body.Close()
 
 					// Attempt to create an object whose value size exceeds the small quota.
 					largeValue := strings.Repeat("x", 200)
@@ -321,7 +437,7 @@ var _ = Describe("Integration Tests", func() {
 			userCountStr := strconv.Itoa(userCount)
 			BeforeEach(func() {
 				userCountStr = strconv.Itoa(userCount)
-				resp := registerUser("batchUser"+userCountStr, "batchPass", 1073741824)
+				resp := registerUser("batchUser"+userCountStr, "batchPass")
 				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
 				tkn, _ := loginUser("batchUser"+userCountStr, "batchPass")
 				token = tkn
@@ -581,6 +697,1921 @@ var _ = Describe("Integration Tests", func() {
 		})
 	})
 
+	Describe("Compare and Swap", func() {
+		var token string
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("casUser", "casPass")
+			}
+			resp := createObject(token, "cas-key", map[string]any{"a": float64(1), "b": "two"}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		})
+
+		AfterEach(func() {
+			cleanup(token, "cas-key")
+		})
+
+		It("should replace the value when the expected JSON matches", func() {
+			resp := doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key:      "cas-key",
+				Expected: json.RawMessage(`{"b": "two", "a": 1}`),
+				Value:    map[string]any{"a": float64(2)},
+				TTL:      getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			obj, respGet := getObject(token, "cas-key")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			Expect(obj.Value).To(Equal(map[string]any{"a": float64(2)}))
+		})
+
+		It("should reject the swap when the expected JSON differs", func() {
+			resp := doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key:      "cas-key",
+				Expected: json.RawMessage(`{"a": 1}`),
+				Value:    map[string]any{"a": float64(3)},
+				TTL:      getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			obj, respGet := getObject(token, "cas-key")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			Expect(obj.Value).To(Equal(map[string]any{"a": float64(1), "b": "two"}))
+		})
+
+		It("should compare large integers exactly", func() {
+			// 2^53 + 1 is stored as 2^53, the closest float64.
+			resp := createObject(token, "cas-key", map[string]any{"n": json.Number("9007199254740993")}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key:      "cas-key",
+				Expected: json.RawMessage(`{"n": 9007199254740993}`),
+				Value:    map[string]any{"n": float64(1)},
+				TTL:      getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key:      "cas-key",
+				Expected: json.RawMessage(`{"n": 9007199254740992}`),
+				Value:    map[string]any{"n": float64(1)},
+				TTL:      getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+		})
+
+		It("should return not found for a missing key", func() {
+			resp := doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key:      "cas-missing",
+				Expected: json.RawMessage(`{}`),
+				Value:    map[string]any{},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Locks", func() {
+		var token string
+		decodeLock := func(resp *http.Response) types.Lock {
+			defer resp.Body.Close()
+			var lock types.Lock
+			Expect(json.NewDecoder(resp.Body).Decode(&lock)).To(Succeed())
+			return lock
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("lockUser", "lockPass")
+			}
+		})
+
+		It("should acquire, renew and release a lock with increasing fencing tokens", func() {
+			resp := doRequest(http.MethodPost, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-1", Lease: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			first := decodeLock(resp)
+			Expect(first.Owner).To(Equal("worker-1"))
+
+			resp = doRequest(http.MethodPost, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-2", Lease: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPut, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-1", Lease: 60})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(decodeLock(resp).TTL).To(BeNumerically(">=", first.TTL))
+
+			resp = doRequest(http.MethodDelete, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-2"})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-1"})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+			resp = doRequest(http.MethodPost, "/api/lock/jobs", token, types.LockRequest{Owner: "worker-2", Lease: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			second := decodeLock(resp)
+			Expect(second.FencingToken).To(BeNumerically(">", first.FencingToken))
+
+			resp = doRequest(http.MethodGet, "/api/lock/jobs", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(decodeLock(resp).Owner).To(Equal("worker-2"))
+		})
+
+		It("should let another owner acquire an expired lock", func() {
+			resp := doRequest(http.MethodPost, "/api/lock/short", token, types.LockRequest{Owner: "worker-1", Lease: 1})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			time.Sleep(2 * time.Second)
+
+			resp = doRequest(http.MethodPost, "/api/lock/short", token, types.LockRequest{Owner: "worker-2", Lease: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(decodeLock(resp).Owner).To(Equal("worker-2"))
+		})
+	})
+
+	Describe("Queues", func() {
+		var token string
+		decodeMessage := func(resp *http.Response) types.QueueMessage {
+			defer resp.Body.Close()
+			var msg types.QueueMessage
+			Expect(json.NewDecoder(resp.Body).Decode(&msg)).To(Succeed())
+			return msg
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("queueUser", "queuePass")
+			}
+		})
+
+		It("should deliver messages in FIFO order and delete them on ack", func() {
+			for _, v := range []string{"first", "second"} {
+				resp := doRequest(http.MethodPost, "/api/queue/orders/message", token, types.QueueMessage{Value: v})
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				resp.Body.Close()
+			}
+
+			resp := doRequest(http.MethodPost, "/api/queue/orders/dequeue", token, types.DequeueRequest{VisibilityTimeout: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			msg := decodeMessage(resp)
+			Expect(msg.Value).To(Equal("first"))
+			Expect(msg.Deliveries).To(Equal(1))
+
+			resp = doRequest(http.MethodDelete, fmt.Sprintf("/api/queue/orders/message/%d", msg.ID), token, types.AckRequest{Receipt: "wrong"})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, fmt.Sprintf("/api/queue/orders/message/%d", msg.ID), token, types.AckRequest{Receipt: msg.Receipt})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+			resp = doRequest(http.MethodPost, "/api/queue/orders/dequeue", token, types.DequeueRequest{VisibilityTimeout: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(decodeMessage(resp).Value).To(Equal("second"))
+
+			resp = doRequest(http.MethodPost, "/api/queue/orders/dequeue", token, types.DequeueRequest{VisibilityTimeout: 30})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should dead letter a message after its last delivery times out", func() {
+			resp := doRequest(http.MethodPost, "/api/queue/poison/message", token, types.QueueMessage{Value: "bad", MaxDeliveries: 1})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/queue/poison/dequeue", token, types.DequeueRequest{VisibilityTimeout: 1})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			time.Sleep(2 * time.Second)
+
+			resp = doRequest(http.MethodPost, "/api/queue/poison/dequeue", token, types.DequeueRequest{VisibilityTimeout: 1})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+
+			resp = doRequest(http.MethodGet, "/api/queue/poison/dead", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var dead []types.QueueMessage
+			Expect(json.NewDecoder(resp.Body).Decode(&dead)).To(Succeed())
+			resp.Body.Close()
+			Expect(dead).To(HaveLen(1))
+			Expect(dead[0].Value).To(Equal("bad"))
+
+			resp = doRequest(http.MethodDelete, fmt.Sprintf("/api/queue/poison/dead/%d", dead[0].ID), token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	Describe("Secondary Indexes", func() {
+		var token string
+		queryIndex := func(name string, query types.IndexQuery) []types.Object {
+			resp := doRequest(http.MethodPost, "/api/index/"+name+"/query", token, query)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+			var objs []types.Object
+			Expect(json.NewDecoder(resp.Body).Decode(&objs)).To(Succeed())
+			return objs
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("indexUser", "indexPass")
+			}
+		})
+
+		It("should query objects by equality and range on indexed fields", func() {
+			resp := createObject(token, "customer-1", map[string]any{"email": "a@example.com", "age": 30}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+			for _, index := range []types.Index{{Name: "email", Path: "$.email"}, {Name: "age", Path: "$.age"}} {
+				resp = doRequest(http.MethodPost, "/api/index", token, index)
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				resp.Body.Close()
+			}
+
+			// Objects written after the index exists are indexed on write.
+			resp = createObject(token, "customer-2", map[string]any{"email": "b@example.com", "age": 40}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+			objs := queryIndex("email", types.IndexQuery{Eq: "a@example.com"})
+			Expect(objs).To(HaveLen(1))
+			Expect(objs[0].Key).To(Equal("customer-1"))
+
+			objs = queryIndex("age", types.IndexQuery{Gte: 35})
+			Expect(objs).To(HaveLen(1))
+			Expect(objs[0].Key).To(Equal("customer-2"))
+
+			// Updates and deletes are reflected in the index.
+			resp = createObject(token, "customer-2", map[string]any{"email": "b@example.com", "age": 20}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			Expect(queryIndex("age", types.IndexQuery{Gte: 35})).To(BeEmpty())
+
+			Expect(deleteObject(token, "customer-1").StatusCode).To(Equal(http.StatusNoContent))
+			Expect(queryIndex("email", types.IndexQuery{Eq: "a@example.com"})).To(BeEmpty())
+		})
+
+		It("should reject queries mixing value types", func() {
+			resp := doRequest(http.MethodPost, "/api/index/age/query", token, types.IndexQuery{Gt: 1, Lt: "z"})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Query", func() {
+		var token string
+		runQuery := func(queryReq types.QueryRequest) types.QueryResponse {
+			resp := doRequest(http.MethodPost, "/api/query", token, queryReq)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+			var queryResp types.QueryResponse
+			Expect(json.NewDecoder(resp.Body).Decode(&queryResp)).To(Succeed())
+			return queryResp
+		}
+
+		BeforeEach(func() {
+			if token != "" {
+				return
+			}
+			token = registerAndLogin("queryUser", "queryPass")
+			for i, status := range []string{"active", "inactive", "active"} {
+				resp := createObject(token, fmt.Sprintf("user-%d", i), map[string]any{"status": status, "age": 20 + i*10}, getTTL())
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			}
+			resp := createObject(token, "other", map[string]any{"status": "active"}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		})
+
+		It("should filter by prefix and expression and project fields", func() {
+			queryResp := runQuery(types.QueryRequest{
+				Prefix: "user-",
+				Filter: &types.Filter{And: []*types.Filter{
+					{Path: "$.status", Op: "eq", Value: "active"},
+					{Or: []*types.Filter{
+						{Path: "$.age", Op: "gte", Value: 40},
+						{Path: "$.missing", Op: "exists"},
+					}},
+				}},
+				Fields: []string{"$.age"},
+			})
+			Expect(queryResp.Objects).To(HaveLen(1))
+			Expect(queryResp.Objects[0].Key).To(Equal("user-2"))
+			Expect(queryResp.Objects[0].Value).To(Equal(map[string]any{"$.age": float64(40)}))
+			Expect(queryResp.Cursor).To(BeEmpty())
+		})
+
+		It("should paginate with a cursor", func() {
+			first := runQuery(types.QueryRequest{Prefix: "user-", Limit: 2})
+			Expect(first.Objects).To(HaveLen(2))
+			Expect(first.Cursor).NotTo(BeEmpty())
+
+			second := runQuery(types.QueryRequest{Prefix: "user-", Limit: 2, Cursor: first.Cursor})
+			Expect(second.Objects).To(HaveLen(1))
+			Expect(second.Objects[0].Key).To(Equal("user-2"))
+			Expect(second.Cursor).To(BeEmpty())
+		})
+
+		It("should reject an invalid filter", func() {
+			resp := doRequest(http.MethodPost, "/api/query", token, types.QueryRequest{
+				Filter: &types.Filter{Path: "$.age", Op: "like", Value: "x"},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+
+		DescribeTable("should reject empty and and or filters",
+			func(filter map[string]any) {
+				resp := doRequest(http.MethodPost, "/api/query", token, map[string]any{"filter": filter})
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+				bodyBytes, err := io.ReadAll(resp.Body)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(string(bodyBytes)).To(ContainSubstring("must have at least one filter"))
+			},
+			Entry("empty and", map[string]any{"and": []any{}}),
+			Entry("empty or", map[string]any{"or": []any{}}),
+			Entry("nested empty and", map[string]any{"or": []any{map[string]any{"and": []any{}}}}),
+		)
+	})
+
+	Describe("Prefix Schemas", func() {
+		var token string
+		BeforeEach(func() {
+			if token != "" {
+				return
+			}
+			token = registerAndLogin("schemaUser", "schemaPass")
+			resp := doRequest(http.MethodPut, "/api/schema", token, types.Schema{
+				Prefix: "order/",
+				Schema: map[string]any{
+					"type":     "object",
+					"required": []string{"id", "total"},
+					"properties": map[string]any{
+						"id":    map[string]any{"type": "string"},
+						"total": map[string]any{"type": "number", "minimum": 0},
+					},
+				},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+		})
+
+		It("should accept conforming values and reject violations with their path", func() {
+			resp := createObject(token, "order/1", map[string]any{"id": "1", "total": 10}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+
+			resp = createObject(token, "order/2", map[string]any{"id": "2", "total": "ten"}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			bodyBytes, err := io.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(string(bodyBytes)).To(ContainSubstring("$.total"))
+
+			// Keys outside the prefix are not validated.
+			resp = createObject(token, "note", "free text", getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+		})
+
+		It("should reject schemas with unsupported keywords", func() {
+			for _, keyword := range []string{"allOf", "anyOf", "oneOf", "not", "$ref", "if", "patternProperties"} {
+				resp := doRequest(http.MethodPut, "/api/schema", token, types.Schema{
+					Prefix: "strict/",
+					Schema: map[string]any{
+						"type":       "object",
+						"properties": map[string]any{"id": map[string]any{"type": "string", keyword: map[string]any{}}},
+					},
+				})
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest), keyword)
+				bodyBytes, err := io.ReadAll(resp.Body)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(string(bodyBytes)).To(ContainSubstring("unsupported keyword"), keyword)
+			}
+
+			resp := doRequest(http.MethodPut, "/api/schema", token, types.Schema{
+				Prefix: "strict/",
+				Schema: map[string]any{"title": "Strict", "description": "annotations are allowed", "type": "object"},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+		})
+
+		It("should validate every object of a batch", func() {
+			resp := doRequest(http.MethodPost, "/api/batch/object", token, []types.Object{
+				{Key: "order/3", Value: map[string]any{"id": "3", "total": 1}, TTL: getTTL()},
+				{Key: "order/4", Value: map[string]any{"id": "4"}, TTL: getTTL()},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			_, respGet := getObject(token, "order/3")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+		})
+
+		It("should validate values swapped, copied or renamed under the prefix", func() {
+			resp := createObject(token, "order/5", map[string]any{"id": "5", "total": 5}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp = doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key: "order/5", Value: map[string]any{"id": "5"}, Expected: json.RawMessage(`{"id": "5", "total": 5}`), TTL: getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = createObject(token, "draft", map[string]any{"id": "6"}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			for _, path := range []string{"/api/object/copy", "/api/object/rename"} {
+				resp = doRequest(http.MethodPost, path, token, types.MoveRequest{Source: "draft", Destination: "order/6"})
+				Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+				bodyBytes, err := io.ReadAll(resp.Body)
+				Expect(err).To(BeNil())
+				resp.Body.Close()
+				Expect(string(bodyBytes)).To(ContainSubstring("violates schema"))
+			}
+			_, respGet := getObject(token, "draft")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+		})
+	})
+
+	Describe("Binary Objects", func() {
+		var token string
+		putBinary := func(key, contentType string, data []byte) *http.Response {
+			req, err := http.NewRequest(http.MethodPut,
+				fmt.Sprintf("%s/api/object/%s?ttl=%d", baseURL, key, getTTL()),
+				bytes.NewBuffer(data))
+			Expect(err).To(BeNil())
+			req.Header.Set("Content-Type", contentType)
+			req.Header.Set("Authorization", token)
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			return resp
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("binaryUser", "binaryPass")
+			}
+		})
+
+		It("should return raw bytes with the stored content type", func() {
+			data := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+			resp := putBinary("image", "image/png", data)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			_, respGet := getObject(token, "image")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			Expect(respGet.Header.Get("Content-Type")).To(Equal("image/png"))
+			body, err := io.ReadAll(respGet.Body)
+			Expect(err).To(BeNil())
+			respGet.Body.Close()
+			Expect(body).To(Equal(data))
+
+			Expect(deleteObject(token, "image").StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should enforce the value size limit on raw bytes", func() {
+			resp := putBinary("too-big", "application/octet-stream", bytes.Repeat([]byte{1}, 16385))
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Chunked Uploads", func() {
+		var token string
+		uploadPart := func(uploadID string, number int, data []byte) *http.Response {
+			req, err := http.NewRequest(http.MethodPut,
+				fmt.Sprintf("%s/api/upload/%s/part/%d", baseURL, uploadID, number),
+				bytes.NewBuffer(data))
+			Expect(err).To(BeNil())
+			req.Header.Set("Authorization", token)
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			return resp
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("uploadUser", "uploadPass")
+			}
+		})
+
+		It("should assemble parts into an object larger than the value size limit", func() {
+			resp := doRequest(http.MethodPost, "/api/upload", token, types.Upload{
+				Key: "large", ContentType: "application/octet-stream", TTL: getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var upload types.Upload
+			Expect(json.NewDecoder(resp.Body).Decode(&upload)).To(Succeed())
+			resp.Body.Close()
+			Expect(upload.ID).NotTo(BeEmpty())
+			// Uploads not completed within a day expire and are refunded.
+			Expect(upload.ExpiresAt).To(BeNumerically("~", time.Now().Add(24*time.Hour).Unix(), 60))
+
+			first := bytes.Repeat([]byte{'a'}, 20000)
+			second := bytes.Repeat([]byte{'b'}, 20000)
+			// Parts may arrive out of order and are assembled by number.
+			resp = uploadPart(upload.ID, 2, second)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			resp = uploadPart(upload.ID, 1, first)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/upload/"+upload.ID+"/complete", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			_, respGet := getObject(token, "large")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(respGet.Body)
+			Expect(err).To(BeNil())
+			respGet.Body.Close()
+			Expect(body).To(Equal(append(first, second...)))
+
+			req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s/api/object/large", baseURL), nil)
+			Expect(err).To(BeNil())
+			req.Header.Set("Authorization", token)
+			req.Header.Set("Range", "bytes=19998-20001")
+			respRange, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			Expect(respRange.StatusCode).To(Equal(http.StatusPartialContent))
+			Expect(respRange.Header.Get("Content-Range")).To(Equal("bytes 19998-20001/40000"))
+			body, err = io.ReadAll(respRange.Body)
+			Expect(err).To(BeNil())
+			respRange.Body.Close()
+			Expect(body).To(Equal([]byte("aabb")))
+
+			Expect(deleteObject(token, "large").StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should reject completing an upload without parts", func() {
+			resp := doRequest(http.MethodPost, "/api/upload", token, types.Upload{
+				Key: "empty", ContentType: "text/plain",
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var upload types.Upload
+			Expect(json.NewDecoder(resp.Body).Decode(&upload)).To(Succeed())
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/upload/"+upload.ID+"/complete", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, "/api/upload/"+upload.ID, token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Value Compression", func() {
+		var token string
+		getQuota := func() types.Quota {
+			resp := doRequest(http.MethodGet, "/api/quota", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var quota types.Quota
+			Expect(json.NewDecoder(resp.Body).Decode(&quota)).To(Succeed())
+			resp.Body.Close()
+			return quota
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("compressionUser", "compressionPass")
+			}
+		})
+
+		It("should charge logical size by default and return values unchanged", func() {
+			Expect(getQuota().Policy).To(Equal(types.LogicalQuotaPolicy))
+
+			value := strings.Repeat("repetitive ", 1000)
+			resp := createObject(token, "logical", value, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			// The JSON encoding adds the two quotes around the string.
+			Expect(getQuota().Utilised).To(Equal(int64(len(value) + 2)))
+
+			obj, respGet := getObject(token, "logical")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal(value))
+
+			Expect(deleteObject(token, "logical").StatusCode).To(Equal(http.StatusNoContent))
+			Expect(getQuota().Utilised).To(Equal(int64(0)))
+		})
+
+		setPolicy := func(adminToken, policy string) *http.Response {
+			return doRequest(http.MethodPut, fmt.Sprintf("/api/admin/tenants/%d/policy", getProfile(token).ID), adminToken, types.PolicyUpdate{Policy: policy})
+		}
+
+		It("should charge compressed size under the physical policy", func() {
+			// Tenants cannot choose their own policy.
+			resp := setPolicy(token, types.PhysicalQuotaPolicy)
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			resp = setPolicy(loginAdmin(), types.PhysicalQuotaPolicy)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var tenant types.Tenant
+			Expect(json.NewDecoder(resp.Body).Decode(&tenant)).To(Succeed())
+			resp.Body.Close()
+			Expect(tenant.Quota.Policy).To(Equal(types.PhysicalQuotaPolicy))
+
+			value := strings.Repeat("repetitive ", 1000)
+			resp = createObject(token, "physical", value, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			Expect(getQuota().Utilised).To(BeNumerically("<", len(value)/10))
+
+			obj, respGet := getObject(token, "physical")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal(value))
+
+			Expect(deleteObject(token, "physical").StatusCode).To(Equal(http.StatusNoContent))
+			Expect(getQuota().Utilised).To(Equal(int64(0)))
+		})
+
+		It("should reject unknown policies", func() {
+			resp := setPolicy(loginAdmin(), "compressed")
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Encryption at Rest", func() {
+		// The specs that inspect the database need DATABASE_URL, and the
+		// rotation spec also the master keys the server runs with.
+		var token string
+		note := strings.Repeat("confidential ", 200)
+
+		upload := func(key string, parts ...[]byte) {
+			resp := doRequest(http.MethodPost, "/api/upload", token, types.Upload{
+				Key: key, ContentType: "application/octet-stream", TTL: getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var created types.Upload
+			Expect(json.NewDecoder(resp.Body).Decode(&created)).To(Succeed())
+			resp.Body.Close()
+
+			for idx, part := range parts {
+				req, err := http.NewRequest(http.MethodPut,
+					fmt.Sprintf("%s/api/upload/%s/part/%d", baseURL, created.ID, idx+1),
+					bytes.NewBuffer(part))
+				Expect(err).To(BeNil())
+				req.Header.Set("Authorization", token)
+				resp, err := http.DefaultClient.Do(req)
+				Expect(err).To(BeNil())
+				Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				resp.Body.Close()
+			}
+			resp = doRequest(http.MethodPost, "/api/upload/"+created.ID+"/complete", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+		}
+
+		getNote := func(key string) string {
+			obj, resp := getObject(token, key)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			return obj.Value.(map[string]any)["note"].(string)
+		}
+
+		getBinary := func(key string) []byte {
+			_, resp := getObject(token, key)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			body, err := io.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			return body
+		}
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("encryptionUser", "encryptionPass")
+			}
+		})
+
+		It("should return compressed values through GET, index queries, uploads, copies and renames", func() {
+			resp := createObject(token, "sealed", map[string]any{"email": "sealed@example.com", "note": note}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			Expect(getNote("sealed")).To(Equal(note))
+
+			resp = doRequest(http.MethodPost, "/api/index", token, types.Index{Name: "sealed-email", Path: "$.email"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, "/api/index/sealed-email/query", token, types.IndexQuery{Eq: "sealed@example.com"})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var objs []types.Object
+			Expect(json.NewDecoder(resp.Body).Decode(&objs)).To(Succeed())
+			resp.Body.Close()
+			Expect(objs).To(HaveLen(1))
+			Expect(objs[0].Value.(map[string]any)["note"]).To(Equal(note))
+
+			// Encrypted values are bound to their key and sealed again when
+			// they move.
+			resp = doRequest(http.MethodPost, "/api/object/copy", token, types.MoveRequest{Source: "sealed", Destination: "sealed-copy"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, "/api/object/rename", token, types.MoveRequest{Source: "sealed-copy", Destination: "sealed-renamed"})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			Expect(getNote("sealed-renamed")).To(Equal(note))
+			Expect(getNote("sealed")).To(Equal(note))
+
+			first := bytes.Repeat([]byte("first part "), 2000)
+			second := bytes.Repeat([]byte("second part "), 2000)
+			upload("sealed-large", first, second)
+			Expect(getBinary("sealed-large")).To(Equal(append(first, second...)))
+
+			resp = doRequest(http.MethodPost, "/api/object/copy", token, types.MoveRequest{Source: "sealed-large", Destination: "sealed-large-copy"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			Expect(getBinary("sealed-large-copy")).To(Equal(append(first, second...)))
+		})
+
+		It("should not store values in plaintext", func() {
+			db := openDatabase()
+			// The value is below the compression threshold, so only encryption
+			// can hide it.
+			resp := createObject(token, "plain", map[string]any{"note": "confidential"}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			upload("plain-large", []byte(note))
+			id := getProfile(token).ID
+
+			var dataValue, dataBlob []byte
+			var encrypted bool
+			err := db.QueryRow("SELECT data_value, data_blob, encrypted FROM data_store WHERE user_id = ? AND data_key = ?", id, "plain").
+				Scan(&dataValue, &dataBlob, &encrypted)
+			Expect(err).To(BeNil())
+			if !encrypted {
+				Skip("the server runs without a master key")
+			}
+			Expect(dataValue).To(BeNil())
+			Expect(dataBlob).NotTo(ContainSubstring("confidential"))
+
+			var chunk []byte
+			err = db.QueryRow("SELECT data FROM object_chunks WHERE user_id = ? AND data_key = ?", id, "plain-large").Scan(&chunk)
+			Expect(err).To(BeNil())
+			Expect(chunk).NotTo(ContainSubstring("confidential"))
+		})
+
+		It("should keep values readable after the master key is rotated", func() {
+			db := openDatabase()
+			current, err := keyring.Load()
+			Expect(err).To(BeNil())
+			if current == nil {
+				Skip("MASTER_KEYS or MASTER_KEY_FILE is not set")
+			}
+			resp := createObject(token, "rotated", map[string]any{"note": note}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			id := getProfile(token).ID
+
+			// Starting with a new active master key re-wraps every data key.
+			// The keys are wrapped with the current key again afterwards, as
+			// the server does not know the new one.
+			newKey := make([]byte, keyring.KeySize)
+			_, err = rand.Read(newKey)
+			Expect(err).To(BeNil())
+			GinkgoT().Setenv("MASTER_KEYS", os.Getenv("MASTER_KEYS")+",rotation-test:"+base64.StdEncoding.EncodeToString(newKey))
+			start := func(active string) *mysql.MysqlDB {
+				GinkgoT().Setenv("ACTIVE_MASTER_KEY_ID", active)
+				msDB := &mysql.MysqlDB{}
+				msDB.Init()
+				DeferCleanup(msDB.Db.Close)
+				return msDB
+			}
+			defer func() { start(current.ActiveID()) }()
+
+			rotated := start("rotation-test")
+			var masterKeyID string
+			Expect(db.QueryRow("SELECT master_key_id FROM tenant_keys WHERE user_id = ?", id).Scan(&masterKeyID)).To(Succeed())
+			Expect(masterKeyID).To(Equal("rotation-test"))
+
+			obj, err := rotated.GetObject(int(id), "rotated")
+			Expect(err).To(BeNil())
+			Expect(obj.Value.(map[string]any)["note"]).To(Equal(note))
+		})
+	})
+
+	Describe("Client Envelope Encryption", func() {
+		ctx := context.Background()
+		var keys *client.StaticKeyProvider
+		var sdk *client.Client
+
+		BeforeEach(func() {
+			if sdk == nil {
+				var err error
+				keys, err = client.NewStaticKeyProvider("kek-1", map[string][]byte{"kek-1": bytes.Repeat([]byte{7}, 32)})
+				Expect(err).To(BeNil())
+				sdk = client.New(baseURL, client.WithKeyProvider(keys))
+				Expect(sdk.Register(ctx, "sdkUser", "sdkPass")).To(Succeed())
+				Expect(sdk.Login(ctx, "sdkUser", "sdkPass")).To(Succeed())
+			}
+		})
+
+		It("should store only ciphertext and decrypt on read", func() {
+			value := map[string]any{"card": "4111111111111111"}
+			Expect(sdk.CreateObject(ctx, "secret", value, getTTL())).To(Succeed())
+
+			var got map[string]any
+			_, err := sdk.GetObject(ctx, "secret", &got)
+			Expect(err).To(BeNil())
+			Expect(got).To(Equal(value))
+
+			plain := client.New(baseURL)
+			Expect(plain.Login(ctx, "sdkUser", "sdkPass")).To(Succeed())
+			var stored map[string]any
+			_, err = plain.GetObject(ctx, "secret", &stored)
+			Expect(err).To(BeNil())
+			Expect(stored).To(HaveKey("kvds_envelope"))
+			raw, err := json.Marshal(stored)
+			Expect(err).To(BeNil())
+			Expect(string(raw)).NotTo(ContainSubstring("4111111111111111"))
+			Expect(string(raw)).To(ContainSubstring(`"key_id":"kek-1"`))
+
+			// The key id is also a tag, so objects can be found per key.
+			keysWithKEK, err := sdk.KeysEncryptedWith(ctx, "kek-1", "")
+			Expect(err).To(BeNil())
+			Expect(keysWithKEK).To(ContainElement("secret"))
+			keysWithKEK, err = sdk.KeysEncryptedWith(ctx, "kek-2", "")
+			Expect(err).To(BeNil())
+			Expect(keysWithKEK).To(BeEmpty())
+
+			Expect(sdk.DeleteObject(ctx, "secret")).To(Succeed())
+		})
+
+		It("should refuse values that are not envelopes", func() {
+			plain := client.New(baseURL)
+			Expect(plain.Login(ctx, "sdkUser", "sdkPass")).To(Succeed())
+			Expect(plain.CreateObject(ctx, "plain", "not encrypted", getTTL())).To(Succeed())
+
+			_, err := sdk.GetObject(ctx, "plain", nil)
+			Expect(err).To(MatchError(client.ErrNotEncrypted))
+
+			Expect(sdk.DeleteObject(ctx, "plain")).To(Succeed())
+		})
+	})
+
+	Describe("Object Metadata", func() {
+		var token string
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("metadataUser", "metadataPass")
+			}
+		})
+
+		It("should keep the creation time and tags across writes", func() {
+			resp := doRequest(http.MethodPost, "/api/object", token, types.Object{
+				Key: "tagged", Value: 1, TTL: getTTL(), Tags: map[string]string{"env": "prod"},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			created, respGet := getObject(token, "tagged")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(created.Tags).To(Equal(map[string]string{"env": "prod"}))
+			Expect(created.CreatedAt).NotTo(BeZero())
+			Expect(created.UpdatedAt).To(Equal(created.CreatedAt))
+
+			time.Sleep(1100 * time.Millisecond)
+			resp = doRequest(http.MethodPost, "/api/object/cas", token, types.CASRequest{
+				Key: "tagged", Expected: json.RawMessage(`1`), Value: 2, TTL: getTTL(),
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			updated, respGet := getObject(token, "tagged")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(updated.Tags).To(Equal(created.Tags))
+			Expect(updated.CreatedAt).To(Equal(created.CreatedAt))
+			Expect(updated.UpdatedAt).To(BeNumerically(">", created.UpdatedAt))
+
+			Expect(deleteObject(token, "tagged").StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should report metadata without the value", func() {
+			resp := createObject(token, "meta", map[string]any{"a": 1}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodHead, "/api/object/meta", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			Expect(resp.Header.Get("X-Object-Size")).To(Equal(strconv.Itoa(len(`{"a":1}`))))
+			Expect(resp.Header.Get("X-Object-Version")).To(Equal("1"))
+			Expect(resp.Header.Get("Content-Type")).To(Equal("application/json"))
+
+			resp = createObject(token, "meta", map[string]any{"a": 2}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodGet, "/api/metadata/meta", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var meta types.ObjectMetadata
+			Expect(json.NewDecoder(resp.Body).Decode(&meta)).To(Succeed())
+			resp.Body.Close()
+			Expect(meta.Version).To(Equal(int64(2)))
+			Expect(meta.Size).To(Equal(int64(len(`{"a":2}`))))
+			Expect(meta.CreatedAt).NotTo(BeZero())
+
+			Expect(deleteObject(token, "meta").StatusCode).To(Equal(http.StatusNoContent))
+			resp = doRequest(http.MethodHead, "/api/object/meta", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			resp.Body.Close()
+		})
+
+		It("should filter queries by tags", func() {
+			resp := doRequest(http.MethodPost, "/api/batch/object", token, []types.Object{
+				{Key: "tag-a", Value: "a", TTL: getTTL(), Tags: map[string]string{"team": "blue", "tier": "gold"}},
+				{Key: "tag-b", Value: "b", TTL: getTTL(), Tags: map[string]string{"team": "blue"}},
+				{Key: "tag-c", Value: "c", TTL: getTTL()},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/query", token, types.QueryRequest{
+				Prefix: "tag-", Tags: map[string]string{"team": "blue"},
+			})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var result types.QueryResponse
+			Expect(json.NewDecoder(resp.Body).Decode(&result)).To(Succeed())
+			resp.Body.Close()
+			keys := []string{}
+			for _, obj := range result.Objects {
+				keys = append(keys, obj.Key)
+			}
+			Expect(keys).To(Equal([]string{"tag-a", "tag-b"}))
+
+			for _, key := range []string{"tag-a", "tag-b", "tag-c"} {
+				Expect(deleteObject(token, key).StatusCode).To(Equal(http.StatusNoContent))
+			}
+		})
+
+		It("should reject too many tags", func() {
+			tags := map[string]string{}
+			for i := 0; i < 17; i++ {
+				tags[fmt.Sprintf("t%d", i)] = "v"
+			}
+			resp := doRequest(http.MethodPost, "/api/object", token, types.Object{Key: "many-tags", Value: 1, Tags: tags})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Copy and Rename", func() {
+		var token string
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("moveUser", "movePass")
+			}
+		})
+
+		getUtilised := func() int64 {
+			resp := doRequest(http.MethodGet, "/api/quota", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+			var quota types.Quota
+			Expect(json.NewDecoder(resp.Body).Decode(&quota)).To(Succeed())
+			return quota.Utilised
+		}
+
+		It("should copy an object and charge the copy to the quota", func() {
+			resp := createObject(token, "copy-src", map[string]any{"a": 1}, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			before := getUtilised()
+
+			resp = doRequest(http.MethodPost, "/api/object/copy", token, types.MoveRequest{Source: "copy-src", Destination: "copy-dst"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			Expect(getUtilised()).To(Equal(2 * before))
+
+			obj, respGet := getObject(token, "copy-dst")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal(map[string]any{"a": float64(1)}))
+
+			for _, key := range []string{"copy-src", "copy-dst"} {
+				Expect(deleteObject(token, key).StatusCode).To(Equal(http.StatusNoContent))
+			}
+			Expect(getUtilised()).To(Equal(int64(0)))
+		})
+
+		It("should rename an object", func() {
+			resp := createObject(token, "rename-src", "value", getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			before := getUtilised()
+
+			resp = doRequest(http.MethodPost, "/api/object/rename", token, types.MoveRequest{Source: "rename-src", Destination: "rename-dst"})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			Expect(getUtilised()).To(Equal(before))
+
+			_, respGet := getObject(token, "rename-src")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+			obj, respGet := getObject(token, "rename-dst")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal("value"))
+
+			Expect(deleteObject(token, "rename-dst").StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should only replace an existing destination when asked to", func() {
+			for _, key := range []string{"move-a", "move-b"} {
+				resp := createObject(token, key, key, getTTL())
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				resp.Body.Close()
+			}
+
+			resp := doRequest(http.MethodPost, "/api/object/rename", token, types.MoveRequest{Source: "move-a", Destination: "move-b"})
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/object/rename", token, types.MoveRequest{Source: "move-a", Destination: "move-b", Overwrite: true})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			obj, respGet := getObject(token, "move-b")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal("move-a"))
+
+			Expect(deleteObject(token, "move-b").StatusCode).To(Equal(http.StatusNoContent))
+			Expect(getUtilised()).To(Equal(int64(0)))
+		})
+
+		It("should return not found for a missing source", func() {
+			resp := doRequest(http.MethodPost, "/api/object/copy", token, types.MoveRequest{Source: "missing", Destination: "elsewhere"})
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Refresh Tokens and Logout", func() {
+		login := func(name, password string) map[string]string {
+			resp := doRequest(http.MethodPost, "/api/auth/login", "", types.User{Name: name, Password: password})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+			var tokens map[string]string
+			Expect(json.NewDecoder(resp.Body).Decode(&tokens)).To(Succeed())
+			Expect(tokens["token"]).NotTo(BeEmpty())
+			Expect(tokens["refresh_token"]).NotTo(BeEmpty())
+			return tokens
+		}
+
+		refresh := func(refreshToken string) (map[string]string, *http.Response) {
+			resp := doRequest(http.MethodPost, "/api/auth/refresh", "", types.RefreshRequest{RefreshToken: refreshToken})
+			defer resp.Body.Close()
+			var tokens map[string]string
+			if resp.StatusCode == http.StatusOK {
+				Expect(json.NewDecoder(resp.Body).Decode(&tokens)).To(Succeed())
+			}
+			return tokens, resp
+		}
+
+		BeforeEach(func() {
+			resp := registerUser("sessionUser", "sessionPass")
+			resp.Body.Close()
+		})
+
+		It("should issue new tokens for a refresh token only once", func() {
+			tokens := login("sessionUser", "sessionPass")
+
+			refreshed, resp := refresh(tokens["refresh_token"])
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(refreshed["refresh_token"]).NotTo(Equal(tokens["refresh_token"]))
+
+			_, respGet := getObject(refreshed["token"], "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+
+			_, resp = refresh(tokens["refresh_token"])
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should revoke both tokens on logout", func() {
+			tokens := login("sessionUser", "sessionPass")
+
+			resp := doRequest(http.MethodPost, "/api/auth/logout", tokens["token"], nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+
+			_, respGet := getObject(tokens["token"], "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusUnauthorized))
+			respGet.Body.Close()
+
+			_, resp = refresh(tokens["refresh_token"])
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+
+			// Other sessions of the user are not affected.
+			other := login("sessionUser", "sessionPass")
+			_, respGet = getObject(other["token"], "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+		})
+	})
+
+	Describe("API Keys", func() {
+		var token string
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("apiKeyUser", "apiKeyPass")
+			}
+		})
+
+		It("should authenticate with an API key until it is revoked", func() {
+			resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "billing-service"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var created types.APIKey
+			Expect(json.NewDecoder(resp.Body).Decode(&created)).To(Succeed())
+			resp.Body.Close()
+			Expect(created.Key).To(HavePrefix("kvds_"))
+
+			resp = createObject(created.Key, "api-key-object", "value", getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			obj, respGet := getObject(token, "api-key-object")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal("value"))
+
+			resp = doRequest(http.MethodGet, "/api/keys", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var keys []types.APIKey
+			Expect(json.NewDecoder(resp.Body).Decode(&keys)).To(Succeed())
+			resp.Body.Close()
+			Expect(keys).To(HaveLen(1))
+			Expect(keys[0].Name).To(Equal("billing-service"))
+			Expect(keys[0].Key).To(BeEmpty())
+			Expect(keys[0].LastUsedAt).NotTo(BeZero())
+
+			resp = doRequest(http.MethodDelete, "/api/keys/"+created.ID, token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+
+			_, respGet = getObject(created.Key, "api-key-object")
+			Expect(respGet.StatusCode).To(Equal(http.StatusUnauthorized))
+			respGet.Body.Close()
+
+			Expect(deleteObject(token, "api-key-object").StatusCode).To(Equal(http.StatusNoContent))
+		})
+
+		It("should reject keys without a name or with a past expiry", func() {
+			resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "expired", ExpiresAt: time.Now().Add(-time.Hour).Unix()})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Scoped Credentials", func() {
+		var token string
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("scopeUser", "scopePass")
+			}
+		})
+
+		It("should restrict an API key to reading a prefix", func() {
+			for _, key := range []string{"reports/daily", "secrets/db"} {
+				resp := createObject(token, key, key, getTTL())
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				resp.Body.Close()
+			}
+
+			resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "dashboard", Scopes: []string{"read:reports/"}})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var key types.APIKey
+			Expect(json.NewDecoder(resp.Body).Decode(&key)).To(Succeed())
+			resp.Body.Close()
+
+			_, respGet := getObject(key.Key, "reports/daily")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+
+			_, respGet = getObject(key.Key, "secrets/db")
+			Expect(respGet.StatusCode).To(Equal(http.StatusForbidden))
+			respGet.Body.Close()
+
+			resp = createObject(key.Key, "reports/weekly", "value", getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			resp = deleteObject(key.Key, "reports/daily")
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/query", key.Key, types.QueryRequest{Prefix: "reports/"})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, "/api/query", key.Key, types.QueryRequest{})
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			// Routes that do not check scopes refuse restricted credentials.
+			resp = doRequest(http.MethodGet, "/api/quota", key.Key, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			for _, key := range []string{"reports/daily", "secrets/db"} {
+				Expect(deleteObject(token, key).StatusCode).To(Equal(http.StatusNoContent))
+			}
+		})
+
+		It("should issue scoped tokens on login", func() {
+			resp := doRequest(http.MethodPost, "/api/auth/login", "", types.User{Name: "scopeUser", Password: "scopePass", Scopes: []string{"read"}})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var tokens map[string]string
+			Expect(json.NewDecoder(resp.Body).Decode(&tokens)).To(Succeed())
+			resp.Body.Close()
+
+			_, respGet := getObject(tokens["token"], "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+
+			resp = createObject(tokens["token"], "read-only", "value", getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+		})
+
+		It("should reject unknown permissions", func() {
+			resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "bad", Scopes: []string{"admin"}})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+	})
+
+	Describe("Signing Keys", func() {
+		It("should publish the key that signed a token", func() {
+			resp, err := http.Get(baseURL + "/.well-known/jwks.json")
+			Expect(err).To(BeNil())
+			defer resp.Body.Close()
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			Expect(resp.Header.Get("Cache-Control")).To(ContainSubstring("max-age"))
+
+			var jwks struct {
+				Keys []struct {
+					Kid string `json:"kid"`
+					Alg string `json:"alg"`
+				} `json:"keys"`
+			}
+			Expect(json.NewDecoder(resp.Body).Decode(&jwks)).To(Succeed())
+
+			token := registerAndLogin("jwksUser", "jwksPass")
+			segment, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+			Expect(err).To(BeNil())
+			var header struct {
+				Kid string `json:"kid"`
+				Alg string `json:"alg"`
+			}
+			Expect(json.Unmarshal(segment, &header)).To(Succeed())
+
+			// Servers without a key directory sign with the HS256 secret, which is
+			// never published.
+			if header.Alg == "HS256" {
+				Expect(header.Kid).To(BeEmpty())
+				return
+			}
+			found := false
+			for _, key := range jwks.Keys {
+				if key.Kid == header.Kid {
+					Expect(key.Alg).To(Equal(header.Alg))
+					found = true
+				}
+			}
+			Expect(found).To(BeTrue())
+		})
+	})
+
+	Describe("External Identity Provider", func() {
+		// The server accepts tokens of the stand-in provider when it runs with
+		// OIDC_ISSUER and OIDC_AUDIENCE set to the same values, for example
+		// http://localhost:8090 and kvds-test. The provider's key is derived
+		// from a fixed seed so that it matches the keys the server cached on
+		// earlier runs.
+		issuer, audience := os.Getenv("OIDC_ISSUER"), os.Getenv("OIDC_AUDIENCE")
+		providerKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+
+		BeforeEach(func() {
+			if issuer == "" || audience == "" {
+				Skip("OIDC_ISSUER and OIDC_AUDIENCE are not set")
+			}
+			issuerURL, err := url.Parse(issuer)
+			Expect(err).To(BeNil())
+			listener, err := net.Listen("tcp", issuerURL.Host)
+			Expect(err).To(BeNil())
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/jwks"})
+			})
+			mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+				json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+					"kty": "OKP", "crv": "Ed25519", "kid": "test", "alg": "EdDSA", "use": "sig",
+					"x": base64.RawURLEncoding.EncodeToString(providerKey.Public().(ed25519.PublicKey)),
+				}}})
+			})
+			provider := &httptest.Server{Listener: listener, Config: &http.Server{Handler: mux}}
+			provider.Start()
+			DeferCleanup(provider.Close)
+		})
+
+		issueToken := func(key ed25519.PrivateKey, claims jwt.MapClaims) string {
+			token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+			token.Header["kid"] = "test"
+			signed, err := token.SignedString(key)
+			Expect(err).To(BeNil())
+			return signed
+		}
+
+		claimsFor := func(subject string) jwt.MapClaims {
+			return jwt.MapClaims{
+				"iss": issuer,
+				"aud": audience,
+				"sub": subject,
+				"exp": time.Now().Add(time.Hour).Unix(),
+			}
+		}
+
+		It("should provision a tenant on first use and map later tokens to it", func() {
+			token := issueToken(providerKey, claimsFor("sso-alice"))
+			resp := createObject(token, "ssoKey", "ssoValue", 0)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			obj, respGet := getObject(issueToken(providerKey, claimsFor("sso-alice")), "ssoKey")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			Expect(obj.Value).To(Equal("ssoValue"))
+
+			respQuota := doRequest(http.MethodGet, "/api/quota", token, nil)
+			Expect(respQuota.StatusCode).To(Equal(http.StatusOK))
+			respQuota.Body.Close()
+
+			// Other identities get a tenant of their own.
+			_, respGet = getObject(issueToken(providerKey, claimsFor("sso-bob")), "ssoKey")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+		})
+
+		It("should reject tokens with the wrong audience, issuer, expiry or key", func() {
+			wrongAudience := claimsFor("sso-alice")
+			wrongAudience["aud"] = "another-service"
+			expired := claimsFor("sso-alice")
+			expired["exp"] = time.Now().Add(-time.Minute).Unix()
+			noExpiry := claimsFor("sso-alice")
+			delete(noExpiry, "exp")
+			noSubject := claimsFor("")
+			otherKey := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{8}, ed25519.SeedSize))
+
+			for _, token := range []string{
+				issueToken(providerKey, wrongAudience),
+				issueToken(providerKey, expired),
+				issueToken(providerKey, noExpiry),
+				issueToken(providerKey, noSubject),
+				issueToken(otherKey, claimsFor("sso-alice")),
+			} {
+				_, resp := getObject(token, "ssoKey")
+				Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+				resp.Body.Close()
+			}
+		})
+	})
+
+	Describe("Client Certificates", func() {
+		// The server verifies client certificates when it runs with TLS and
+		// TLS_CLIENT_CA_FILE. The tests connect to it at TLS_TEST_URL, trusting
+		// TLS_TEST_CA_FILE, with the client certificate in TLS_TEST_CLIENT_CERT
+		// and TLS_TEST_CLIENT_KEY, which must be signed by the client CA and
+		// carry a common name.
+		tlsURL := os.Getenv("TLS_TEST_URL")
+		var withCert, withoutCert *http.Client
+		var commonName string
+
+		BeforeEach(func() {
+			caFile, certFile, keyFile := os.Getenv("TLS_TEST_CA_FILE"), os.Getenv("TLS_TEST_CLIENT_CERT"), os.Getenv("TLS_TEST_CLIENT_KEY")
+			if tlsURL == "" || caFile == "" || certFile == "" || keyFile == "" {
+				Skip("TLS_TEST_URL, TLS_TEST_CA_FILE, TLS_TEST_CLIENT_CERT and TLS_TEST_CLIENT_KEY are not set")
+			}
+			caPEM, err := os.ReadFile(caFile)
+			Expect(err).To(BeNil())
+			roots := x509.NewCertPool()
+			Expect(roots.AppendCertsFromPEM(caPEM)).To(BeTrue())
+			cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+			Expect(err).To(BeNil())
+			leaf, err := x509.ParseCertificate(cert.Certificate[0])
+			Expect(err).To(BeNil())
+			commonName = leaf.Subject.CommonName
+
+			withCert = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{cert}}}}
+			withoutCert = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}}
+		})
+
+		send := func(client *http.Client, method, path string, payload any) *http.Response {
+			var body io.Reader
+			if payload != nil {
+				data, err := json.Marshal(payload)
+				Expect(err).To(BeNil())
+				body = bytes.NewBuffer(data)
+			}
+			req, err := http.NewRequest(method, tlsURL+path, body)
+			Expect(err).To(BeNil())
+			req.Header.Set("Content-Type", contentType)
+			resp, err := client.Do(req)
+			Expect(err).To(BeNil())
+			return resp
+		}
+
+		It("should authenticate only as the tenant the certificate is bound to", func() {
+			adminToken := loginAdmin()
+
+			// Registering the name the certificate carries gains nothing. The
+			// user may exist from an earlier run.
+			resp := send(withoutCert, http.MethodPost, "/api/auth/register", types.User{Name: commonName, Password: "certPass"})
+			Expect(resp.StatusCode).To(BeElementOf(http.StatusCreated, http.StatusBadRequest))
+			resp.Body.Close()
+			resp = send(withCert, http.MethodGet, "/api/object/certKey", nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+			resp.Body.Close()
+
+			token := registerAndLogin("certUser", "certPass")
+			certificates := fmt.Sprintf("/api/admin/tenants/%d/certificates", getProfile(token).ID)
+			binding := types.CertificateBinding{Identity: commonName}
+			resp = doRequest(http.MethodPost, certificates, adminToken, binding)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, certificates, adminToken, binding)
+			Expect(resp.StatusCode).To(Equal(http.StatusConflict))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, certificates, token, binding)
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			resp = send(withCert, http.MethodPost, "/api/object", types.Object{Key: "certKey", Value: "certValue"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			obj, respGet := getObject(token, "certKey")
+			Expect(respGet.StatusCode).To(Equal(http.StatusOK))
+			respGet.Body.Close()
+			Expect(obj.Value).To(Equal("certValue"))
+
+			resp = send(withoutCert, http.MethodGet, "/api/object/certKey", nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusUnauthorized))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, certificates, adminToken, binding)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+			resp = doRequest(http.MethodGet, certificates, adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var bindings []types.CertificateBinding
+			Expect(json.NewDecoder(resp.Body).Decode(&bindings)).To(Succeed())
+			resp.Body.Close()
+			Expect(bindings).To(BeEmpty())
+		})
+	})
+
+	Describe("Signed Requests", func() {
+		// The server has to run with REQUEST_SIGNING_SECRET.
+		var token string
+		var key types.APIKey
+
+		BeforeEach(func() {
+			if token == "" {
+				token = registerAndLogin("signingUser", "signingPass")
+				resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "signer"})
+				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+				Expect(json.NewDecoder(resp.Body).Decode(&key)).To(Succeed())
+				resp.Body.Close()
+			}
+			if key.SigningKey == "" {
+				Skip("the server does not run with REQUEST_SIGNING_SECRET")
+			}
+		})
+
+		// signWith builds a request signed with signingKey like the Go client
+		// does.
+		signWith := func(signingKey, method, path string, body []byte, timestamp int64, nonce string) *http.Request {
+			req, err := http.NewRequest(method, baseURL+path, bytes.NewReader(body))
+			Expect(err).To(BeNil())
+			req.Header.Set("Content-Type", contentType)
+
+			bodyHash := sha256.Sum256(body)
+			mac := hmac.New(sha256.New, []byte(signingKey))
+			fmt.Fprintf(mac, "KVDS-HMAC-SHA256\n%s\n%s\n%d\n%s\n%s", method, req.URL.RequestURI(), timestamp, nonce, hex.EncodeToString(bodyHash[:]))
+			req.Header.Set("Authorization", fmt.Sprintf("KVDS-HMAC-SHA256 Credential=%s, Timestamp=%d, Nonce=%s, Signature=%s",
+				key.ID, timestamp, nonce, hex.EncodeToString(mac.Sum(nil))))
+			return req
+		}
+
+		signedRequest := func(method, path string, body []byte, timestamp int64, nonce string) *http.Request {
+			return signWith(key.SigningKey, method, path, body, timestamp, nonce)
+		}
+
+		send := func(req *http.Request) int {
+			resp, err := http.DefaultClient.Do(req)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			return resp.StatusCode
+		}
+
+		It("should accept requests signed by the client", func() {
+			c := client.New(baseURL, client.WithSigningKey(key.ID, key.SigningKey))
+			ctx := context.Background()
+			Expect(c.CreateObject(ctx, "signed-object", "signed", 0)).To(Succeed())
+			var value string
+			_, err := c.GetObject(ctx, "signed-object", &value)
+			Expect(err).To(BeNil())
+			Expect(value).To(Equal("signed"))
+			Expect(c.DeleteObject(ctx, "signed-object")).To(Succeed())
+		})
+
+		It("should not accept signatures keyed with the stored key hash", func() {
+			keyHash := sha256.Sum256([]byte(key.Key))
+			req := signWith(hex.EncodeToString(keyHash[:]), http.MethodGet, "/api/quota", nil, time.Now().Unix(), "nonce-stored-hash-0001")
+			Expect(send(req)).To(Equal(http.StatusUnauthorized))
+		})
+
+		It("should reject replayed, modified and stale requests", func() {
+			body := []byte(`{"key": "signed-replay", "value": 1}`)
+			now := time.Now().Unix()
+			req := signedRequest(http.MethodPost, "/api/object", body, now, "nonce-replay-0001")
+			Expect(send(req)).To(Equal(http.StatusCreated))
+
+			// The same request again.
+			req = signedRequest(http.MethodPost, "/api/object", body, now, "nonce-replay-0001")
+			Expect(send(req)).To(Equal(http.StatusUnauthorized))
+
+			// A different body under the original signature.
+			req = signedRequest(http.MethodPost, "/api/object", body, now, "nonce-replay-0002")
+			req.Body = io.NopCloser(bytes.NewReader([]byte(`{"key": "signed-replay", "value": 2}`)))
+			req.ContentLength = -1
+			Expect(send(req)).To(Equal(http.StatusUnauthorized))
+
+			// A different path under the original signature.
+			req = signedRequest(http.MethodGet, "/api/object/signed-replay", nil, now, "nonce-replay-0003")
+			req.URL.Path = "/api/object/other"
+			Expect(send(req)).To(Equal(http.StatusUnauthorized))
+
+			req = signedRequest(http.MethodGet, "/api/object/signed-replay", nil, now-600, "nonce-replay-0004")
+			Expect(send(req)).To(Equal(http.StatusUnauthorized))
+
+			obj, resp := getObject(token, "signed-replay")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			Expect(obj.Value).To(BeEquivalentTo(1))
+			Expect(deleteObject(token, "signed-replay").StatusCode).To(Equal(http.StatusNoContent))
+		})
+	})
+
+	Describe("Account Management", func() {
+		It("should return the profile with the quota", func() {
+			token := registerAndLogin("profileUser", "profilePass")
+			resp := createObject(token, "profile-object", "value", 0)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodGet, "/api/account", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var profile types.Profile
+			Expect(json.NewDecoder(resp.Body).Decode(&profile)).To(Succeed())
+			resp.Body.Close()
+			Expect(profile.Name).To(Equal("profileUser"))
+			Expect(profile.ID).NotTo(BeZero())
+			Expect(profile.Quota.Provisioned).To(Equal(int64(1073741824)))
+			Expect(profile.Quota.Utilised).To(BeNumerically(">", 0))
+		})
+
+		It("should change the password and end every session and API key", func() {
+			token := registerAndLogin("passwordUser", "oldPass")
+			other, _ := loginUser("passwordUser", "oldPass")
+			resp := doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "before-reset"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var apiKey types.APIKey
+			Expect(json.NewDecoder(resp.Body).Decode(&apiKey)).To(Succeed())
+			resp.Body.Close()
+			_, respGet := getObject(apiKey.Key, "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+
+			resp = doRequest(http.MethodPut, "/api/account/password", token, types.PasswordChange{CurrentPassword: "wrongPass", NewPassword: "newPass"})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPut, "/api/account/password", token, types.PasswordChange{CurrentPassword: "oldPass", NewPassword: "newPass"})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+
+			for _, t := range []string{token, other, apiKey.Key} {
+				_, respGet := getObject(t, "missing")
+				Expect(respGet.StatusCode).To(Equal(http.StatusUnauthorized))
+				respGet.Body.Close()
+			}
+
+			_, resp = loginUser("passwordUser", "oldPass")
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+			token, resp = loginUser("passwordUser", "newPass")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			_, respGet = getObject(token, "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+		})
+
+		It("should delete the account and its data once confirmed with the password", func() {
+			token := registerAndLogin("deletedUser", "deletedPass")
+			resp := createObject(token, "deleted-object", "value", 0)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, "/api/keys", token, types.APIKey{Name: "deleted-key"})
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			var key types.APIKey
+			Expect(json.NewDecoder(resp.Body).Decode(&key)).To(Succeed())
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, "/api/account", token, types.AccountDeletion{Password: "wrongPass"})
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, "/api/account", token, types.AccountDeletion{Password: "deletedPass"})
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+
+			for _, t := range []string{token, key.Key} {
+				_, respGet := getObject(t, "deleted-object")
+				Expect(respGet.StatusCode).To(Equal(http.StatusUnauthorized))
+				respGet.Body.Close()
+			}
+			_, resp = loginUser("deletedUser", "deletedPass")
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			resp.Body.Close()
+
+			// The name can be registered again, with none of the old data.
+			token = registerAndLogin("deletedUser", "deletedPass")
+			_, respGet := getObject(token, "deleted-object")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+		})
+	})
+
+	Describe("Tenant Administration", func() {
+		// The administrator tests need DATABASE_URL to promote the
+		// administrator.
+		var adminToken string
+
+		profile := func(token string) types.Profile {
+			resp := doRequest(http.MethodGet, "/api/account", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			defer resp.Body.Close()
+			var p types.Profile
+			Expect(json.NewDecoder(resp.Body).Decode(&p)).To(Succeed())
+			return p
+		}
+
+		tenant := func(id int64) (types.Tenant, int) {
+			resp := doRequest(http.MethodGet, fmt.Sprintf("/api/admin/tenants/%d", id), adminToken, nil)
+			defer resp.Body.Close()
+			var t types.Tenant
+			if resp.StatusCode == http.StatusOK {
+				Expect(json.NewDecoder(resp.Body).Decode(&t)).To(Succeed())
+			}
+			return t, resp.StatusCode
+		}
+
+		requireAdmin := func() {
+			if adminToken == "" {
+				adminToken = loginAdmin()
+			}
+		}
+
+		It("should refuse users that are not administrators", func() {
+			token := registerAndLogin("plainUser", "plainPass")
+			Expect(profile(token).Role).To(Equal(types.UserRole))
+			resp := doRequest(http.MethodGet, "/api/admin/tenants", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+		})
+
+		It("should list tenants and change their capacity", func() {
+			requireAdmin()
+			token := registerAndLogin("managedUser", "managedPass")
+			id := profile(token).ID
+
+			resp := doRequest(http.MethodGet, fmt.Sprintf("/api/admin/tenants?after=%d&limit=1", id-1), adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var tenants []types.Tenant
+			Expect(json.NewDecoder(resp.Body).Decode(&tenants)).To(Succeed())
+			resp.Body.Close()
+			Expect(tenants).To(HaveLen(1))
+			Expect(tenants[0].ID).To(Equal(id))
+			Expect(tenants[0].Name).To(Equal("managedUser"))
+			Expect(tenants[0].Quota.Provisioned).To(Equal(int64(1073741824)))
+
+			resp = doRequest(http.MethodPut, fmt.Sprintf("/api/admin/tenants/%d/capacity", id), adminToken, types.CapacityUpdate{Provisioned: 5368709120})
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			Expect(profile(token).Quota.Provisioned).To(Equal(int64(5368709120)))
+		})
+
+		It("should refuse suspended tenants until they are reinstated", func() {
+			requireAdmin()
+			token := registerAndLogin("suspendedUser", "suspendedPass")
+			id := profile(token).ID
+
+			resp := doRequest(http.MethodPost, fmt.Sprintf("/api/admin/tenants/%d/suspend", id), adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			t, _ := tenant(id)
+			Expect(t.Suspended).To(BeTrue())
+
+			_, respGet := getObject(token, "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusForbidden))
+			respGet.Body.Close()
+			_, resp = loginUser("suspendedUser", "suspendedPass")
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodPost, fmt.Sprintf("/api/admin/tenants/%d/unsuspend", id), adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			_, respGet = getObject(token, "missing")
+			Expect(respGet.StatusCode).To(Equal(http.StatusNotFound))
+			respGet.Body.Close()
+
+			resp = doRequest(http.MethodPost, fmt.Sprintf("/api/admin/tenants/%d/suspend", profile(adminToken).ID), adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+		})
+
+		It("should force-delete a tenant with its data", func() {
+			requireAdmin()
+			token := registerAndLogin("removedUser", "removedPass")
+			id := profile(token).ID
+			resp := createObject(token, "removed-object", "value", 0)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			resp = doRequest(http.MethodDelete, fmt.Sprintf("/api/admin/tenants/%d", id), adminToken, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusNoContent))
+			resp.Body.Close()
+
+			_, status := tenant(id)
+			Expect(status).To(Equal(http.StatusNotFound))
+			_, respGet := getObject(token, "removed-object")
+			Expect(respGet.StatusCode).To(Equal(http.StatusUnauthorized))
+			respGet.Body.Close()
+		})
+	})
+
+	Describe("Plans", func() {
+		// The specs expect the built-in plans, with standard as the default.
+		setPlan := func(adminToken string, id int64, plan string) *http.Response {
+			return doRequest(http.MethodPut, fmt.Sprintf("/api/admin/tenants/%d/plan", id), adminToken, types.PlanUpdate{Plan: plan})
+		}
+
+		It("should put new users on the default plan whatever capacity they ask for", func() {
+			body, err := json.Marshal(map[string]any{"user_name": "greedyUser", "password": "greedyPass", "provisioned_capacity": int64(1) << 50})
+			Expect(err).To(BeNil())
+			resp, err := http.Post(fmt.Sprintf("%s/api/auth/register", baseURL), contentType, bytes.NewBuffer(body))
+			Expect(err).To(BeNil())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			token, loginResp := loginUser("greedyUser", "greedyPass")
+			Expect(loginResp.StatusCode).To(Equal(http.StatusOK))
+			quota := getProfile(token).Quota
+			Expect(quota.Plan).To(Equal("standard"))
+			Expect(quota.Provisioned).To(Equal(int64(1073741824)))
+		})
+
+		It("should list the plans", func() {
+			token := registerAndLogin("planListUser", "planListPass")
+			resp := doRequest(http.MethodGet, "/api/plans", token, nil)
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var plans []types.Plan
+			Expect(json.NewDecoder(resp.Body).Decode(&plans)).To(Succeed())
+			resp.Body.Close()
+			names := []string{}
+			for _, plan := range plans {
+				names = append(names, plan.Name)
+			}
+			Expect(names).To(Equal([]string{"enterprise", "free", "standard"}))
+		})
+
+		It("should only let administrators change plans", func() {
+			token := registerAndLogin("planUser", "planPass")
+			id := getProfile(token).ID
+			resp := setPlan(token, id, "enterprise")
+			Expect(resp.StatusCode).To(Equal(http.StatusForbidden))
+			resp.Body.Close()
+
+			adminToken := loginAdmin()
+			resp = setPlan(adminToken, id, "platinum")
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+
+			resp = setPlan(adminToken, id, "free")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			var tenant types.Tenant
+			Expect(json.NewDecoder(resp.Body).Decode(&tenant)).To(Succeed())
+			resp.Body.Close()
+			Expect(tenant.Quota.Plan).To(Equal("free"))
+			Expect(tenant.Quota.Provisioned).To(Equal(int64(104857600)))
+			Expect(getProfile(token).Quota.Plan).To(Equal("free"))
+		})
+
+		It("should apply the value and batch size limits of the plan", func() {
+			adminToken := loginAdmin()
+			token := registerAndLogin("planLimitUser", "planLimitPass")
+			id := getProfile(token).ID
+
+			// 64KB values exceed the standard plan but not the enterprise one.
+			value := strings.Repeat("x", 65536)
+			resp := createObject(token, "planValue", value, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			resp.Body.Close()
+			resp = setPlan(adminToken, id, "enterprise")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			resp = createObject(token, "planValue", value, getTTL())
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			// 2MB batches exceed the free plan but not the standard one.
+			objects := []types.Object{}
+			for i := range 160 {
+				objects = append(objects, types.Object{Key: fmt.Sprintf("planBatch%d", i), Value: strings.Repeat("x", 13107), TTL: getTTL()})
+			}
+			resp = setPlan(adminToken, id, "free")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, "/api/batch/object", token, objects)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			bodyBytes, err := io.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(string(bodyBytes)).To(ContainSubstring("batch size limit exceeded"))
+			resp = setPlan(adminToken, id, "standard")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+			resp = doRequest(http.MethodPost, "/api/batch/object", token, objects)
+			Expect(resp.StatusCode).To(Equal(http.StatusCreated))
+			resp.Body.Close()
+
+			// Batch items are held to the value size limit too.
+			oversized := append(objects[:1:1], types.Object{Key: "planBatchValue", Value: value, TTL: getTTL()})
+			resp = doRequest(http.MethodPost, "/api/batch/object", token, oversized)
+			Expect(resp.StatusCode).To(Equal(http.StatusBadRequest))
+			bodyBytes, err = io.ReadAll(resp.Body)
+			Expect(err).To(BeNil())
+			resp.Body.Close()
+			Expect(string(bodyBytes)).To(ContainSubstring("value size exceeded"))
+			_, resp = getObject(token, "planBatchValue")
+			Expect(resp.StatusCode).To(Equal(http.StatusNotFound))
+			resp.Body.Close()
+		})
+
+		It("should rate limit requests beyond the plan's burst", func() {
+			adminToken := loginAdmin()
+			token := registerAndLogin("planRateUser", "planRatePass")
+			resp := setPlan(adminToken, getProfile(token).ID, "free")
+			Expect(resp.StatusCode).To(Equal(http.StatusOK))
+			resp.Body.Close()
+
+			limited := 0
+			for range 60 {
+				resp := doRequest(http.MethodGet, "/api/quota", token, nil)
+				if resp.StatusCode == http.StatusTooManyRequests {
+					Expect(resp.Header.Get("Retry-After")).NotTo(BeEmpty())
+					limited++
+				} else {
+					Expect(resp.StatusCode).To(Equal(http.StatusOK))
+				}
+				resp.Body.Close()
+			}
+			Expect(limited).To(BeNumerically(">", 0))
+		})
+	})
+
 	Describe("Concurrency Tests", func() {
 		var userTokens []string
 		const numUsers = 150
@@ -592,7 +2623,7 @@ var _ = Describe("Integration Tests", func() {
 				username := fmt.Sprintf("concurrency_user_%d", i)
 				password := fmt.Sprintf("pass_%d", i)
 
-				resp := registerUser(username, password, getTTL())
+				resp := registerUser(username, password)
 				Expect(resp.StatusCode).To(Equal(http.StatusCreated))
 
 				token, loginResp := loginUser(username, password)
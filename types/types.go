@@ -1,19 +1,265 @@
 package types
 
+import "encoding/json"
+
 type User struct {
-	ID                  int64  `json:"id"`
-	Name                string `json:"user_name"`
-	Password            string `json:"password"`
-	ProvisionedCapacity int64  `json:"provisioned_capacity"` // represents the capactiy in B
+	ID       int64  `json:"id"`
+	Name     string `json:"user_name"`
+	Password string `json:"password"`
+
+	// Scopes requested on login restrict the issued tokens.
+	Scopes []string `json:"scopes,omitempty"`
+
+	Role      string `json:"-"`
+	Suspended bool   `json:"-"`
+	Plan      string `json:"-"`
+}
+
+// Roles of users. Administrators manage the other tenants.
+const (
+	UserRole  = "user"
+	AdminRole = "admin"
+)
+
+// Permissions granted by credential scopes.
+const (
+	ReadPermission   = "read"
+	WritePermission  = "write"
+	DeletePermission = "delete"
+)
+
+// Session is a login. Access tokens carry its ID, and its refresh token,
+// stored as a SHA-256 hash, issues new access tokens until the session expires
+// or is revoked.
+type Session struct {
+	ID               string
+	UserID           int64
+	RefreshTokenHash string
+	ExpiresAt        int64
+	Revoked          bool
+	Scopes           []string
+}
+
+// APIKey is a long-lived credential for services, sent in place of an access
+// token. Only a hash of the key is stored, and the key itself is returned once,
+// when it is created.
+type APIKey struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	Key        string `json:"key,omitempty"`
+	SigningKey string `json:"signing_key,omitempty"`
+	ExpiresAt  int64  `json:"expires_at"` // unix timestamp, 0 never expires
+	CreatedAt  int64  `json:"created_at"`
+	LastUsedAt int64  `json:"last_used_at"`
+
+	Scopes []string `json:"scopes,omitempty"`
+
+	UserID  int64  `json:"-"`
+	KeyHash string `json:"-"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Profile describes the account of the authenticated user. Users provisioned
+// through an identity provider have no name.
+type Profile struct {
+	ID    int64  `json:"id"`
+	Name  string `json:"user_name,omitempty"`
+	Role  string `json:"role"`
+	Quota *Quota `json:"quota"`
+}
+
+// Tenant is a user as administrators see it.
+type Tenant struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"user_name,omitempty"`
+	Role      string `json:"role"`
+	Suspended bool   `json:"suspended"`
+	Quota     *Quota `json:"quota"`
+}
+
+type CapacityUpdate struct {
+	Provisioned int64 `json:"provisioned"`
+}
+
+type PlanUpdate struct {
+	Plan string `json:"plan"`
+}
+
+// CertificateBinding lets client certificates carrying Identity authenticate
+// as a tenant.
+type CertificateBinding struct {
+	Identity  string `json:"identity"`
+	CreatedAt int64  `json:"created_at,omitempty"`
+}
+
+type PolicyUpdate struct {
+	Policy string `json:"policy"`
+}
+
+type RoleUpdate struct {
+	Role string `json:"role"`
+}
+
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// AccountDeletion confirms the deletion of an account with its password.
+type AccountDeletion struct {
+	Password string `json:"password"`
 }
 
 type Object struct {
-	Key   string `json:"key"`
-	Value any    `json:"value"`
-	TTL   int64  `json:"ttl"`
+	Key   string            `json:"key"`
+	Value any               `json:"value"`
+	TTL   int64             `json:"ttl"`
+	Tags  map[string]string `json:"tags,omitempty"`
+
+	// Maintained by the server as unix timestamps and ignored on writes.
+	CreatedAt int64 `json:"created_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+
+	// Binary objects carry their raw bytes and content type instead of Value.
+	// Chunked objects are too large to be loaded at once and leave Data empty.
+	Data        []byte `json:"-"`
+	ContentType string `json:"-"`
+	Size        int64  `json:"-"`
+	Chunked     bool   `json:"-"`
+}
+
+// Quota policies decide whether values are charged by their logical size or by
+// the bytes they occupy once compressed.
+const (
+	LogicalQuotaPolicy  = "logical"
+	PhysicalQuotaPolicy = "physical"
+)
+
+// ObjectMetadata describes an object without its value.
+type ObjectMetadata struct {
+	Key         string            `json:"key"`
+	Size        int64             `json:"size"` // bytes of the JSON encoded value or of the raw bytes
+	Version     int64             `json:"version"`
+	ContentType string            `json:"content_type"`
+	TTL         int64             `json:"ttl"`
+	Tags        map[string]string `json:"tags,omitempty"`
+	CreatedAt   int64             `json:"created_at"`
+	UpdatedAt   int64             `json:"updated_at"`
 }
 
 type Quota struct {
-	Provisioned int64 `json:"provisioned"`
-	Utilised    int64 `json:"utilised"`
+	Provisioned int64  `json:"provisioned"`
+	Utilised    int64  `json:"utilised"`
+	Policy      string `json:"policy"`
+	Plan        string `json:"plan"`
+}
+
+// Plan sets the capacity and the limits of the tenants on it. Tenants are
+// provisioned Capacity bytes when they join the plan, and may make RateLimit
+// requests per second on average, in bursts of up to Burst requests.
+type Plan struct {
+	Name         string  `json:"name"`
+	Capacity     int64   `json:"capacity"`
+	MaxValueSize int64   `json:"max_value_size"`
+	MaxBatchSize int64   `json:"max_batch_size"` // bytes of the values of a batch
+	RateLimit    float64 `json:"rate_limit"`     // 0 does not limit requests
+	Burst        int     `json:"burst"`
+}
+
+// MoveRequest copies or renames the object under Source to Destination. An
+// existing destination is only replaced when Overwrite is set.
+type MoveRequest struct {
+	Source      string `json:"source"`
+	Destination string `json:"destination"`
+	Overwrite   bool   `json:"overwrite"`
+}
+
+type CASRequest struct {
+	Key string `json:"key"`
+	// Expected is kept as sent, so that its numbers are compared exactly.
+	Expected json.RawMessage `json:"expected"`
+	Value    any             `json:"value"`
+	TTL      int64           `json:"ttl"`
+}
+
+type Lock struct {
+	Name         string `json:"name"`
+	Owner        string `json:"owner,omitempty"`
+	FencingToken int64  `json:"fencing_token"`
+	TTL          int64  `json:"ttl"`
+}
+
+type LockRequest struct {
+	Owner string `json:"owner"`
+	Lease int64  `json:"lease"` // lease duration in seconds
+}
+
+type QueueMessage struct {
+	ID            int64  `json:"id"`
+	Value         any    `json:"value"`
+	Receipt       string `json:"receipt,omitempty"`
+	Deliveries    int    `json:"deliveries"`
+	MaxDeliveries int    `json:"max_deliveries"`
+}
+
+type DequeueRequest struct {
+	VisibilityTimeout int64 `json:"visibility_timeout"` // in seconds
+}
+
+type AckRequest struct {
+	Receipt string `json:"receipt"`
+}
+
+type Index struct {
+	Name string `json:"name"`
+	Path string `json:"path"` // JSON path inside the value, e.g. $.email
+}
+
+type IndexQuery struct {
+	Eq    any `json:"eq,omitempty"`
+	Gt    any `json:"gt,omitempty"`
+	Gte   any `json:"gte,omitempty"`
+	Lt    any `json:"lt,omitempty"`
+	Lte   any `json:"lte,omitempty"`
+	Limit int `json:"limit"`
+}
+
+// Filter is a node of the query expression tree. A node is either a
+// combination of child filters (And/Or) or a comparison of the field at Path.
+type Filter struct {
+	And   []*Filter `json:"and,omitempty"`
+	Or    []*Filter `json:"or,omitempty"`
+	Path  string    `json:"path,omitempty"`
+	Op    string    `json:"op,omitempty"`
+	Value any       `json:"value,omitempty"`
+}
+
+type QueryRequest struct {
+	Prefix string            `json:"prefix"`
+	Tags   map[string]string `json:"tags"` // objects must carry all of these tags
+	Filter *Filter           `json:"filter"`
+	Fields []string          `json:"fields"`
+	Limit  int               `json:"limit"`
+	Cursor string            `json:"cursor"`
+}
+
+type QueryResponse struct {
+	Objects []*Object `json:"objects"`
+	Cursor  string    `json:"cursor,omitempty"`
+}
+
+type Schema struct {
+	Prefix string `json:"prefix"`
+	Schema any    `json:"schema"` // JSON Schema document
+}
+
+type Upload struct {
+	ID          string `json:"upload_id"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+	TTL         int64  `json:"ttl"`
+	ExpiresAt   int64  `json:"expires_at,omitempty"`
 }
@@ -6,21 +6,90 @@ import (
 )
 
 const (
-	UserExistsErr        = "user already exists"
-	UserNotFoundErr      = "user not found"
-	UserCreateErr        = "error creating user"
-	UserGetErr           = "error getting user"
-	UserCreated          = "user registered successfully"
-	ObjectCreateErr      = "error creating object"
-	ObjectGetErr         = "error getting object"
-	ObjectDeleteErr      = "error deleting object"
-	ObjectBatchCreateErr = "error creating objects"
-	ObjectCreated        = "object created successfully"
-	ObjectNotFoundErr    = "object not found"
-	QuotaExceededErr     = "quota exceeded"
-	InvalidBodyErr       = "invalid request body"
-	EmptyBodyErr         = "empty request body"
-	InvalidCredErr       = "invalid username/password"
+	UserExistsErr           = "user already exists"
+	UserNotFoundErr         = "user not found"
+	UserCreateErr           = "error creating user"
+	UserGetErr              = "error getting user"
+	UserCreated             = "user registered successfully"
+	UserProvisionErr        = "error provisioning user"
+	UserUpdateErr           = "error updating user"
+	UserDeleteErr           = "error deleting user"
+	UserSuspendedErr        = "account is suspended"
+	TenantGetErr            = "error getting tenants"
+	AdminRequiredErr        = "administrator role required"
+	InvalidIdentityTokenErr = "invalid or expired identity provider token"
+	SessionCreateErr        = "error creating session"
+	SessionRefreshErr       = "error refreshing session"
+	SessionRevokeErr        = "error revoking session"
+	SessionGetErr           = "error getting session"
+	SessionRevokedErr       = "session expired or revoked"
+	InvalidRefreshErr       = "invalid or expired refresh token"
+	APIKeyCreateErr         = "error creating api key"
+	APIKeyGetErr            = "error getting api keys"
+	APIKeyDeleteErr         = "error deleting api key"
+	APIKeyNotFoundErr       = "api key not found"
+	APIKeyLimitErr          = "api key limit reached"
+	InvalidAPIKeyErr        = "invalid or expired api key"
+	InvalidSignatureErr     = "request signature does not match"
+	CertificateBindErr      = "error binding certificate"
+	CertificateGetErr       = "error getting certificates"
+	CertificateUnbindErr    = "error unbinding certificate"
+	CertificateNotFoundErr  = "certificate identity not bound"
+	CertificateBoundErr     = "certificate identity already bound"
+	ObjectCreateErr         = "error creating object"
+	ObjectGetErr            = "error getting object"
+	ObjectDeleteErr         = "error deleting object"
+	ObjectBatchCreateErr    = "error creating objects"
+	ObjectCreated           = "object created successfully"
+	ObjectNotFoundErr       = "object not found"
+	ObjectCASErr            = "error swapping object"
+	ObjectCASMismatchErr    = "stored value does not match expected value"
+	ObjectUpdated           = "object updated successfully"
+	ObjectCopyErr           = "error copying object"
+	ObjectRenameErr         = "error renaming object"
+	ObjectExistsErr         = "destination object already exists"
+	ObjectCopied            = "object copied successfully"
+	ObjectRenamed           = "object renamed successfully"
+	QuotaExceededErr        = "quota exceeded"
+	QuotaGetErr             = "error getting quota"
+	RateLimitedErr          = "rate limit of the plan exceeded"
+	LockAcquireErr          = "error acquiring lock"
+	LockRenewErr            = "error renewing lock"
+	LockReleaseErr          = "error releasing lock"
+	LockGetErr              = "error getting lock"
+	LockHeldErr             = "lock is held by another owner"
+	LockNotHeldErr          = "lock is not held by the owner"
+	LockNotFoundErr         = "lock not found"
+	QueueEnqueueErr         = "error enqueuing message"
+	QueueDequeueErr         = "error dequeuing message"
+	QueueAckErr             = "error acknowledging message"
+	QueueGetErr             = "error getting messages"
+	MessageNotFoundErr      = "message not found"
+	InvalidReceiptErr       = "invalid or expired receipt"
+	IndexCreateErr          = "error creating index"
+	IndexDeleteErr          = "error deleting index"
+	IndexGetErr             = "error getting indexes"
+	IndexQueryErr           = "error querying index"
+	IndexExistsErr          = "index already exists"
+	IndexNotFoundErr        = "index not found"
+	IndexCreated            = "index created successfully"
+	ObjectScanErr           = "error scanning objects"
+	SchemaPutErr            = "error saving schema"
+	SchemaGetErr            = "error getting schemas"
+	SchemaDeleteErr         = "error deleting schema"
+	SchemaNotFoundErr       = "schema not found"
+	SchemaSaved             = "schema saved successfully"
+	UploadCreateErr         = "error creating upload"
+	UploadPartErr           = "error uploading part"
+	UploadCompleteErr       = "error completing upload"
+	UploadAbortErr          = "error aborting upload"
+	UploadExpireErr         = "error expiring upload"
+	UploadNotFoundErr       = "upload not found"
+	UploadEmptyErr          = "upload has no parts"
+	PartUploaded            = "part uploaded successfully"
+	InvalidBodyErr          = "invalid request body"
+	EmptyBodyErr            = "empty request body"
+	InvalidCredErr          = "invalid username/password"
 )
 
 type Error struct {
@@ -71,6 +140,20 @@ func ErrForbidden(msg string, params ...any) error {
 	return NewError(http.StatusForbidden, msg, params...)
 }
 
+func ErrConflict(msg string, params ...any) error {
+	if msg == "" {
+		msg = "conflict"
+	}
+	return NewError(http.StatusConflict, msg, params...)
+}
+
+func ErrTooManyRequests(msg string, params ...any) error {
+	if msg == "" {
+		msg = "too many requests"
+	}
+	return NewError(http.StatusTooManyRequests, msg, params...)
+}
+
 func ErrInternalServer(msg string, params ...any) error {
 	if msg == "" {
 		msg = "internal server error"
@@ -84,3 +167,10 @@ func ErrStatusCreated(msg string, params ...any) error {
 	}
 	return NewError(http.StatusCreated, msg, params...)
 }
+
+func ErrStatusOK(msg string, params ...any) error {
+	if msg == "" {
+		msg = "ok"
+	}
+	return NewError(http.StatusOK, msg, params...)
+}
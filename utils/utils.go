@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"io"
 	"log/slog"
@@ -30,6 +32,28 @@ func ExtractRequestBody(reqBody io.ReadCloser, bodyObj any) error {
 	return nil
 }
 
+// ReadRawBody reads a non-empty request body of at most limit bytes.
+func ReadRawBody(reqBody io.ReadCloser, limit int64) ([]byte, error) {
+	if reqBody == nil {
+		return nil, ErrBadRequest(EmptyBodyErr)
+	}
+
+	defer reqBody.Close()
+
+	body, err := io.ReadAll(io.LimitReader(reqBody, limit+1))
+	if err != nil {
+		slog.Error("error reading request body", "error", err)
+		return nil, ErrBadRequest(InvalidBodyErr)
+	}
+	if len(body) == 0 {
+		return nil, ErrBadRequest(EmptyBodyErr)
+	}
+	if int64(len(body)) > limit {
+		return nil, ErrBadRequest("request body exceeds %d bytes", limit)
+	}
+	return body, nil
+}
+
 func MarshalResponse(resp any) ([]byte, error) {
 	switch resp := resp.(type) {
 	case []byte:
@@ -39,6 +63,15 @@ func MarshalResponse(resp any) ([]byte, error) {
 	}
 }
 
+// RandomToken returns a hex encoded random string built from n random bytes.
+func RandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
 func InitEnv() {
 	err := godotenv.Load()
 	if err != nil {
@@ -46,7 +79,7 @@ func InitEnv() {
 		os.Exit(1)
 	}
 
-	envVars := []string{"DATABASE_URL", "JWT_SECRET_KEY"}
+	envVars := []string{"DATABASE_URL"}
 
 	for _, envVar := range envVars {
 		if os.Getenv(envVar) == "" {